@@ -23,6 +23,12 @@ import (
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+//+kubebuilder:printcolumn:name="CA",type="string",JSONPath=".status.ca.subject",priority=1
+//+kubebuilder:printcolumn:name="CA Expires",type="date",JSONPath=".status.ca.notAfter"
+//+kubebuilder:printcolumn:name="Last Check",type="date",JSONPath=".status.lastCheckTime"
+//+kubebuilder:printcolumn:name="Last Issuance",type="date",JSONPath=".status.lastIssuanceTime",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SCEPClusterIssuer is the Schema for the clusterissuers API
 type SCEPClusterIssuer struct {
@@ -26,24 +26,185 @@ type SCEPIssuerSpec struct {
 	// for example: "https://sample-signer.example.com/api".
 	URL string `json:"url"`
 
+	// CAIdentifier selects the CA if the SCEP server hosts several CAs. It is
+	// sent as message with the GetCACaps and GetCACert operations, and the
+	// PKIOperations are encrypted to the certificates returned for this CA.
+	// +optional
+	CAIdentifier string `json:"caIdentifier,omitempty"`
+
+	// CAFingerprints are hex encoded SHA-256 fingerprints of trusted CA
+	// certificates. The CA and RA certificates returned by the SCEP server
+	// have to match one of them or chain to a matching certificate.
+	// +optional
+	CAFingerprints []string `json:"caFingerprints,omitempty"`
+
+	// CABundle is a PEM encoded bundle of trusted CA certificates. The CA and
+	// RA certificates returned by the SCEP server have to be in the bundle or
+	// chain to one of its certificates.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
 	// A reference to a Secret in the same namespace as the referent. If the
 	// referent is a ClusterIssuer, the reference instead refers to the resource
 	// with the given name in the configured 'cluster resource namespace', which
 	// is set as a flag on the controller component (and defaults to the
 	// namespace that the controller runs in).
 	AuthSecretName string `json:"authSecretName"`
+
+	// ContentEncryptionAlgorithm is the cipher used to encrypt the
+	// pkcsPKIEnvelope of requests. If not set, the strongest cipher the SCEP
+	// server advertises is used.
+	// +optional
+	ContentEncryptionAlgorithm ContentEncryptionAlgorithm `json:"contentEncryptionAlgorithm,omitempty"`
+
+	// DigestAlgorithm is the digest used to sign requests. If not set, the
+	// strongest digest the SCEP server advertises is used.
+	// +optional
+	DigestAlgorithm DigestAlgorithm `json:"digestAlgorithm,omitempty"`
+
+	// PendingPollInterval is how often the SCEP server is polled for a
+	// request it answered with PENDING. Defaults to 30s, which is also used
+	// if the interval is not positive.
+	// +optional
+	PendingPollInterval *metav1.Duration `json:"pendingPollInterval,omitempty"`
+
+	// MaxPendingDuration is how long a request may stay pending at the SCEP
+	// server before the CertificateRequest is failed. If not set or not
+	// positive, the request is polled until the server decides on it.
+	// +optional
+	MaxPendingDuration *metav1.Duration `json:"maxPendingDuration,omitempty"`
+
+	// Timeout is how long every HTTP request to the SCEP server may take.
+	// Defaults to 30s.
+	// +optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// TLS configures the HTTPS connections to the SCEP server.
+	// +optional
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Keyless enrolls CertificateRequests without reading the Secret named by
+	// their cert-manager.io/private-key-secret-name annotation. Requests are
+	// signed with a transient RSA key and the CSR is sent unchanged, so the
+	// challenge password is not added to it and certificates are not renewed
+	// with a RenewalReq. CertificateRequests without the annotation, e.g. those
+	// of csi-driver or istio-csr, are always enrolled keyless.
+	// +optional
+	Keyless bool `json:"keyless,omitempty"`
+}
+
+// ContentEncryptionAlgorithm is a cipher for the pkcsPKIEnvelope of a SCEP
+// message.
+// +kubebuilder:validation:Enum=DES3;AES-128-CBC;AES-256-CBC
+type ContentEncryptionAlgorithm string
+
+const (
+	ContentEncryptionDES3      ContentEncryptionAlgorithm = "DES3"
+	ContentEncryptionAES128CBC ContentEncryptionAlgorithm = "AES-128-CBC"
+	ContentEncryptionAES256CBC ContentEncryptionAlgorithm = "AES-256-CBC"
+)
+
+// DigestAlgorithm is a message digest used to sign a SCEP message.
+// +kubebuilder:validation:Enum=SHA-1;SHA-256;SHA-512
+type DigestAlgorithm string
+
+const (
+	DigestSHA1   DigestAlgorithm = "SHA-1"
+	DigestSHA256 DigestAlgorithm = "SHA-256"
+	DigestSHA512 DigestAlgorithm = "SHA-512"
+)
+
+// TLSConfig configures the HTTPS connections to a SCEP server.
+type TLSConfig struct {
+	// CABundle is a PEM encoded bundle of the CA certificates the HTTPS
+	// certificate of the SCEP server is verified with. If not set, the system
+	// roots are used.
+	// +optional
+	CABundle []byte `json:"caBundle,omitempty"`
+
+	// ClientCertificateSecretName names a kubernetes.io/tls Secret with the
+	// client certificate and key presented to servers which require mutual
+	// TLS. It is read from the namespace of the auth Secret.
+	// +optional
+	ClientCertificateSecretName string `json:"clientCertificateSecretName,omitempty"`
+
+	// ServerName is sent with SNI and the HTTPS certificate of the SCEP
+	// server is verified against it instead of the host of the URL.
+	// +optional
+	ServerName string `json:"serverName,omitempty"`
+
+	// MinVersion is the minimum TLS version. Defaults to TLS12.
+	// +optional
+	MinVersion TLSVersion `json:"minVersion,omitempty"`
 }
 
+// TLSVersion is a version of the TLS protocol.
+// +kubebuilder:validation:Enum=TLS12;TLS13
+type TLSVersion string
+
+const (
+	TLSVersion12 TLSVersion = "TLS12"
+	TLSVersion13 TLSVersion = "TLS13"
+)
+
 // SCEPIssuerStatus defines the observed state of Issuer
 type SCEPIssuerStatus struct {
 	// List of status conditions to indicate the status of a CertificateRequest.
 	// Known condition types are `Ready`.
 	// +optional
 	Status `json:",inline"`
+
+	// Capabilities advertised by the SCEP server in its GetCACaps response.
+	// The signer chooses the HTTP method, digest and cipher from them.
+	// +optional
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// CA is the certificate of the CA which issues the certificates, as
+	// returned by the SCEP server on the last successful health check.
+	// +optional
+	CA *CertificateInfo `json:"ca,omitempty"`
+
+	// RA are the RA certificates returned by the SCEP server on the last
+	// successful health check, if it has an RA.
+	// +optional
+	RA []CertificateInfo `json:"ra,omitempty"`
+
+	// ObservedGeneration is the generation of the issuer the status was last
+	// updated for.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// LastCheckTime is the time of the last successful health check of the
+	// SCEP server.
+	// +optional
+	LastCheckTime *metav1.Time `json:"lastCheckTime,omitempty"`
+
+	// LastIssuanceTime is the time the issuer last issued a certificate.
+	// +optional
+	LastIssuanceTime *metav1.Time `json:"lastIssuanceTime,omitempty"`
+}
+
+// CertificateInfo describes a CA or RA certificate of a SCEP server.
+type CertificateInfo struct {
+	// Subject is the distinguished name of the certificate.
+	Subject string `json:"subject"`
+
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the certificate,
+	// in the format of caFingerprints.
+	Fingerprint string `json:"fingerprint"`
+
+	// NotAfter is the time the certificate expires.
+	NotAfter metav1.Time `json:"notAfter"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status"
+//+kubebuilder:printcolumn:name="CA",type="string",JSONPath=".status.ca.subject",priority=1
+//+kubebuilder:printcolumn:name="CA Expires",type="date",JSONPath=".status.ca.notAfter"
+//+kubebuilder:printcolumn:name="Last Check",type="date",JSONPath=".status.lastCheckTime"
+//+kubebuilder:printcolumn:name="Last Issuance",type="date",JSONPath=".status.lastIssuanceTime",priority=1
+//+kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // SCEPIssuer is the Schema for the issuers API
 type SCEPIssuer struct {
@@ -18,37 +18,81 @@ package controllers
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"crypto"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 
 	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/mheers/scep-external-issuer/issuer/metrics"
 	signer "github.com/mheers/scep-external-issuer/issuer/signer"
 	issuerutil "github.com/mheers/scep-external-issuer/issuer/util"
 
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+)
+
+const (
+	// Annotations on the CertificateRequest which hold the state of a SCEP
+	// transaction that the server answered with PENDING. They do not change
+	// while the transaction is polled.
+	pendingStateAnnotationPrefix = "cert-manager.heers.it/scep-"
+	transactionIDAnnotation      = pendingStateAnnotationPrefix + "transaction-id"
+	signerCertificateAnnotation  = pendingStateAnnotationPrefix + "signer-certificate"
+	signerKeyAnnotation          = pendingStateAnnotationPrefix + "signer-key"
+	// pendingSinceAnnotation holds the time the SCEP server first answered
+	// the request with PENDING.
+	pendingSinceAnnotation = "cert-manager.heers.it/scep-pending-since"
+
+	defaultPendingPollInterval = 30 * time.Second
+
+	// eventReasonEnrollmentSent is the reason of the Event recorded when a
+	// request is sent to the SCEP server
+	eventReasonEnrollmentSent = "EnrollmentSent"
+	// eventReasonEnrollmentRejected is the reason of the Event recorded when
+	// the SCEP server answers FAILURE but the request is retried
+	eventReasonEnrollmentRejected = "EnrollmentRejected"
+
+	// issuerRefField indexes CertificateRequests of our group by the Kind
+	// and name of their issuerRef
+	issuerRefField = "spec.issuerRef"
 )
 
 var (
-	errIssuerRef      = errors.New("error interpreting issuerRef")
-	errGetIssuer      = errors.New("error getting issuer")
-	errIssuerNotReady = errors.New("issuer is not ready")
-	errSignerBuilder  = errors.New("failed to build the signer")
-	errSignerSign     = errors.New("failed to sign")
+	errIssuerRef          = errors.New("error interpreting issuerRef")
+	errGetIssuer          = errors.New("error getting issuer")
+	errIssuerNotReady     = errors.New("issuer is not ready")
+	errSignerBuilder      = errors.New("failed to build the signer")
+	errSignerSign         = errors.New("failed to sign")
+	errPendingState       = errors.New("failed to read the pending SCEP transaction")
+	errUpdatePendingState = errors.New("failed to store the pending SCEP transaction")
+	errCertificateChain   = errors.New("failed to build the certificate chain")
+	errTransactionID      = errors.New("failed to derive the SCEP transactionID")
+	errPendingTimeout     = errors.New("the SCEP server did not decide on the request in time")
+	errPrivateKey         = errors.New("unusable private key")
+	errGetPrivateKey      = errors.New("failed to get the private key Secret")
+	errGetCertificate     = errors.New("failed to get the certificate to renew")
 )
 
 // CertificateRequestReconciler reconciles a CertificateRequest object
@@ -60,10 +104,19 @@ type CertificateRequestReconciler struct {
 
 	Clock                  clock.Clock
 	CheckApprovedCondition bool
+	// Recorder records the SCEP conversation as Events on the
+	// CertificateRequest.
+	Recorder record.EventRecorder
 }
 
-// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests,verbs=get;list;watch;update;patch
 // +kubebuilder:rbac:groups=cert-manager.io,resources=certificaterequests/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+// +kubebuilder:rbac:groups=cert-manager.heers.it,resources=scepissuers/status;scepclusterissuers/status,verbs=patch
+
+// Annotation for generating RBAC role for reading Secrets. The private key
+// Secrets are read in the namespaces of the CertificateRequests, so the cached
+// client of the manager lists and watches Secrets in all namespaces.
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (result ctrl.Result, err error) {
@@ -76,6 +129,7 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 			return ctrl.Result{}, fmt.Errorf("unexpected get error: %v", err)
 		}
 		log.Info("Not found. Ignoring.")
+		metrics.ForgetPending(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
@@ -133,6 +187,10 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 			err = utilerrors.NewAggregate([]error{err, updateErr})
 			result = ctrl.Result{}
 		}
+		_, hasTransaction := certificateRequest.Annotations[transactionIDAnnotation]
+		ready := cmutil.GetCertificateRequestCondition(&certificateRequest, cmapi.CertificateRequestConditionReady)
+		isPending := hasTransaction && ready != nil && ready.Reason == cmapi.CertificateRequestReasonPending
+		metrics.SetPending(req.NamespacedName, certificateRequest.Spec.IssuerRef.Kind, issuerLabel(&certificateRequest), isPending)
 	}()
 
 	// If CertificateRequest has been denied, mark the CertificateRequest as
@@ -162,7 +220,8 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 	if ready := cmutil.GetCertificateRequestCondition(&certificateRequest, cmapi.CertificateRequestConditionReady); ready == nil {
 		log.Info("Initialising Ready condition")
 		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, "Initialising")
-		return ctrl.Result{}, nil
+		// ignoreOwnUpdates filters the update of the Ready condition
+		return ctrl.Result{Requeue: true}, nil
 	}
 
 	// Ignore but log an error if the issuerRef.Kind is unrecognised
@@ -216,44 +275,400 @@ func (r *CertificateRequestReconciler) Reconcile(ctx context.Context, req ctrl.R
 		Namespace: secretNamespace,
 	}
 
-	var secret corev1.Secret
-	if err := r.Get(ctx, secretName, &secret); err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, secretName, err)
+	secretData, err := issuerSecretData(ctx, r.Client, issuerSpec, secretName)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
-	privateKeyName := types.NamespacedName{
-		Name:      certificateRequest.Annotations["cert-manager.io/private-key-secret-name"],
-		Namespace: secretNamespace,
-	}
-	var privateKey corev1.Secret
-	if err := r.Get(ctx, privateKeyName, &privateKey); err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w, privateKey name: %s, reason: %v", errGetAuthSecret, secretName, err)
-	}
-	privateKeyPEM := privateKey.Data["tls.key"]
-	privateKeyPEMData, _ := pem.Decode(privateKeyPEM)
-	privateKeyRSA, err := x509.ParsePKCS8PrivateKey(privateKeyPEMData.Bytes)
-	if err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w, privateKey name: %s, reason: %v", errGetAuthSecret, secretName, err)
+	// CertificateRequests of csi-driver, istio-csr or those created by hand
+	// have no private key Secret, they are enrolled keyless
+	privateKeySecretName := certificateRequest.Annotations[cmapi.CertificateRequestPrivateKeyAnnotationKey]
+	keyless := issuerSpec.Keyless || privateKeySecretName == ""
+	var privateKeySigner crypto.Signer
+	var existingCertificate []byte
+	if keyless {
+		log = log.WithValues("keyless", true)
+	} else {
+		// the private key Secret belongs to the Certificate, so it is in the
+		// namespace of the CertificateRequest for ClusterIssuers too
+		privateKeyName := types.NamespacedName{
+			Name:      privateKeySecretName,
+			Namespace: certificateRequest.Namespace,
+		}
+		var privateKey corev1.Secret
+		if err := r.Get(ctx, privateKeyName, &privateKey); err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w, privateKey name: %s, reason: %v", errGetPrivateKey, privateKeyName, err)
+		}
+		// a malformed key or one that does not belong to the CSR will not be
+		// fixed by retrying the request
+		privateKeySigner, err = issuerutil.PrivateKeyForCSR(privateKey.Data[corev1.TLSPrivateKeyKey], certificateRequest.Spec.Request)
+		if err != nil {
+			err = fmt.Errorf("%w, privateKey name: %s, reason: %v", errPrivateKey, privateKeyName, err)
+			log.Error(err, "Unusable private key. Marking as failed.")
+			nowTime := metav1.NewTime(r.Clock.Now())
+			certificateRequest.Status.FailureTime = &nowTime
+			setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+			return ctrl.Result{}, nil
+		}
+		existingCertificate, err = r.existingCertificate(ctx, &certificateRequest)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errGetCertificate, err)
+		}
 	}
 
-	signer, err := r.SignerBuilder(issuerSpec, secret.Data)
+	issuerSigner, err := r.SignerBuilder(log, issuerSpec, issuerStatus, secretData)
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerBuilder, err)
 	}
 
-	signed, err := signer.SignWithPrivateKey(certificateRequest.Spec.Request, privateKeyRSA.(*rsa.PrivateKey))
+	pendingState := pendingStateFromAnnotations(certificateRequest.Annotations)
+
+	// the transactionID of a new request is derived from the UID, so a retry
+	// after a lost status update continues the same transaction at the CA
+	var transactionID string
+	if pendingState == nil {
+		transactionID, err = signer.TransactionID(string(certificateRequest.UID), certificateRequest.Spec.Request)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errTransactionID, err)
+		}
+		log = log.WithValues("transactionID", transactionID)
+	}
+
+	var signed *signer.SignedCertificate
+	enrollmentStart := time.Now()
+	switch {
+	case pendingState == nil && keyless:
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeNormal, eventReasonEnrollmentSent, "Sending keyless enrollment request to the SCEP server, transactionID: %s", transactionID)
+		signed, err = issuerSigner.Sign(ctx, certificateRequest.Spec.Request, transactionID)
+	case pendingState == nil && len(existingCertificate) > 0:
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeNormal, eventReasonEnrollmentSent, "Sending renewal request to the SCEP server, transactionID: %s", transactionID)
+		signed, err = issuerSigner.RenewWithPrivateKey(ctx, certificateRequest.Spec.Request, privateKeySigner, existingCertificate, transactionID)
+	case pendingState == nil:
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeNormal, eventReasonEnrollmentSent, "Sending enrollment request to the SCEP server, transactionID: %s", transactionID)
+		signed, err = issuerSigner.SignWithPrivateKey(ctx, certificateRequest.Spec.Request, privateKeySigner, transactionID)
+	default:
+		log = log.WithValues("transactionID", pendingState.TransactionID)
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeNormal, eventReasonEnrollmentSent, "Polling the SCEP server for the pending request, transactionID: %s", pendingState.TransactionID)
+		signed, err = issuerSigner.PollWithPrivateKey(ctx, certificateRequest.Spec.Request, privateKeySigner, pendingState)
+	}
+	outcome, failInfo := enrollmentOutcome(err)
+	metrics.ObserveEnrollment(certificateRequest.Spec.IssuerRef.Kind, issuerLabel(&certificateRequest), outcome, failInfo, time.Since(enrollmentStart))
+	var pendingErr *signer.PendingError
+	if errors.As(err, &pendingErr) {
+		pendingSince := r.Clock.Now()
+		if since, ok := certificateRequest.Annotations[pendingSinceAnnotation]; ok {
+			if pendingSince, err = time.Parse(time.RFC3339, since); err != nil {
+				return ctrl.Result{}, fmt.Errorf("%w: invalid %s annotation: %v", errPendingState, pendingSinceAnnotation, err)
+			}
+		}
+		if maxPending := issuerSpec.MaxPendingDuration; maxPending != nil && maxPending.Duration > 0 && r.Clock.Since(pendingSince) >= maxPending.Duration {
+			err := fmt.Errorf("%w: %v, still pending after %s", errPendingTimeout, pendingErr, maxPending.Duration)
+			log.Error(err, "Giving up on the pending SCEP request. Marking as failed.")
+			r.Recorder.Event(&certificateRequest, corev1.EventTypeWarning, cmapi.CertificateRequestReasonFailed, err.Error())
+			nowTime := metav1.NewTime(r.Clock.Now())
+			certificateRequest.Status.FailureTime = &nowTime
+			setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+			return ctrl.Result{}, nil
+		}
+
+		pollInterval := defaultPendingPollInterval
+		if issuerSpec.PendingPollInterval != nil && issuerSpec.PendingPollInterval.Duration > 0 {
+			pollInterval = issuerSpec.PendingPollInterval.Duration
+		}
+		log.Info("SCEP request is pending. Polling again later.", "transactionID", pendingErr.State.TransactionID, "pollInterval", pollInterval)
+		// the annotations are only written when the transaction starts, so
+		// polling does not update the CertificateRequest
+		if setPendingStateAnnotations(&certificateRequest, pendingErr.State, pendingSince) {
+			if err := r.Update(ctx, &certificateRequest); err != nil {
+				return ctrl.Result{}, fmt.Errorf("%w: %v", errUpdatePendingState, err)
+			}
+		}
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeNormal, cmapi.CertificateRequestReasonPending, "The SCEP server answered PENDING, transactionID: %s, polling again in %s", pendingErr.State.TransactionID, pollInterval)
+		setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, pendingErr.Error())
+		return ctrl.Result{RequeueAfter: pollInterval}, nil
+	}
+	// requests the SCEP server rejected permanently are not retried, other
+	// errors are returned so the request is retried with backoff
+	var failureErr *signer.FailureError
+	if errors.As(err, &failureErr) {
+		if failureErr.Permanent() {
+			r.Recorder.Eventf(&certificateRequest, corev1.EventTypeWarning, cmapi.CertificateRequestReasonFailed, "The SCEP server answered FAILURE, failInfo: %s", failureErr.FailInfo)
+			err = fmt.Errorf("%w: %v", errSignerSign, err)
+			log.Error(err, "The SCEP server rejected the request. Marking as failed.")
+			nowTime := metav1.NewTime(r.Clock.Now())
+			certificateRequest.Status.FailureTime = &nowTime
+			setReadyCondition(cmmeta.ConditionFalse, cmapi.CertificateRequestReasonFailed, err.Error())
+			return ctrl.Result{}, nil
+		}
+		r.Recorder.Eventf(&certificateRequest, corev1.EventTypeWarning, eventReasonEnrollmentRejected, "The SCEP server answered FAILURE, failInfo: %s, retrying", failureErr.FailInfo)
+	}
 	if err != nil {
 		return ctrl.Result{}, fmt.Errorf("%w: %v", errSignerSign, err)
 	}
-	certificateRequest.Status.Certificate = signed
+	certificateRequest.Status.Certificate = signed.Certificate
+	if len(signed.CAChain) > 0 {
+		// intermediates are appended to the certificate, the root CA
+		// ends up in the ca.crt of the certificate Secret
+		bundle, err := pki.ParseSingleCertificateChainPEM(append(append([]byte{}, signed.Certificate...), signed.CAChain...))
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errCertificateChain, err)
+		}
+		certificateRequest.Status.Certificate = bundle.ChainPEM
+		certificateRequest.Status.CA = bundle.CAPEM
+	}
 
 	setReadyCondition(cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, "Signed")
+	r.Recorder.Event(&certificateRequest, corev1.EventTypeNormal, cmapi.CertificateRequestReasonIssued, issuedMessage(signed.Certificate))
+
+	// the certificate is issued even if the issuer status cannot be updated
+	if err := r.setLastIssuanceTime(ctx, issuer, issuerStatus); err != nil {
+		log.Error(err, "Failed to record the issuance in the issuer status.")
+	}
 	return ctrl.Result{}, nil
 }
 
+// enrollmentOutcome returns the outcome and failInfo metric labels of an
+// enrollment that returned err.
+func enrollmentOutcome(err error) (string, string) {
+	var pendingErr *signer.PendingError
+	var failureErr *signer.FailureError
+	switch {
+	case err == nil:
+		return metrics.OutcomeIssued, ""
+	case errors.As(err, &pendingErr):
+		return metrics.OutcomePending, ""
+	case errors.As(err, &failureErr):
+		return metrics.OutcomeFailed, metrics.FailInfoLabel(failureErr.FailInfo)
+	default:
+		return metrics.OutcomeError, ""
+	}
+}
+
+// issuerLabel returns the issuer metric label of the issuer of a
+// CertificateRequest.
+func issuerLabel(cr *cmapi.CertificateRequest) string {
+	if cr.Spec.IssuerRef.Kind == "SCEPClusterIssuer" {
+		return metrics.IssuerLabel("", cr.Spec.IssuerRef.Name)
+	}
+	return metrics.IssuerLabel(cr.Namespace, cr.Spec.IssuerRef.Name)
+}
+
+// issuedMessage returns the message of the Event recorded when the SCEP
+// server answered SUCCESS.
+func issuedMessage(certificate []byte) string {
+	cert, err := pki.DecodeX509CertificateBytes(certificate)
+	if err != nil {
+		return "The SCEP server answered SUCCESS"
+	}
+	return fmt.Sprintf("The SCEP server answered SUCCESS, serial number: %x", cert.SerialNumber)
+}
+
+// setLastIssuanceTime records the current time as the time the issuer last
+// issued a certificate. Only this field is patched, so the status written by
+// the issuer reconciler is kept.
+func (r *CertificateRequestReconciler) setLastIssuanceTime(ctx context.Context, issuer client.Object, issuerStatus *scepissuerapi.SCEPIssuerStatus) error {
+	patch := client.MergeFrom(issuer.DeepCopyObject().(client.Object))
+	now := metav1.NewTime(r.Clock.Now())
+	issuerStatus.LastIssuanceTime = &now
+	return r.Status().Patch(ctx, issuer, patch)
+}
+
+// pendingStateFromAnnotations returns the state of a pending SCEP transaction
+// stored on a CertificateRequest, or nil if there is none.
+func pendingStateFromAnnotations(annotations map[string]string) *signer.PendingState {
+	transactionID, ok := annotations[transactionIDAnnotation]
+	if !ok {
+		return nil
+	}
+	return &signer.PendingState{
+		TransactionID:     transactionID,
+		SignerCertificate: []byte(annotations[signerCertificateAnnotation]),
+		SignerKey:         []byte(annotations[signerKeyAnnotation]),
+	}
+}
+
+// setPendingStateAnnotations stores state on cr. It returns whether an
+// annotation changed.
+func setPendingStateAnnotations(cr *cmapi.CertificateRequest, state signer.PendingState, since time.Time) bool {
+	annotations := map[string]string{
+		transactionIDAnnotation:     state.TransactionID,
+		signerCertificateAnnotation: string(state.SignerCertificate),
+		pendingSinceAnnotation:      since.UTC().Format(time.RFC3339),
+	}
+	if len(state.SignerKey) > 0 {
+		// the transient key of a request for a non-RSA key
+		annotations[signerKeyAnnotation] = string(state.SignerKey)
+	}
+	if cr.Annotations == nil {
+		cr.Annotations = map[string]string{}
+	}
+	changed := false
+	for key, value := range annotations {
+		if current, ok := cr.Annotations[key]; !ok || current != value {
+			cr.Annotations[key] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+// issuerRefIndexValue returns the value of the issuerRefField index for an
+// issuer of the given Kind and name.
+func issuerRefIndexValue(kind, name string) string {
+	return kind + "/" + name
+}
+
+// indexIssuerRef returns the issuerRef of a CertificateRequest for the
+// issuerRefField index. Requests of foreign groups are not indexed.
+func indexIssuerRef(o client.Object) []string {
+	cr, ok := o.(*cmapi.CertificateRequest)
+	if !ok || cr.Spec.IssuerRef.Group != scepissuerapi.GroupVersion.Group {
+		return nil
+	}
+	return []string{issuerRefIndexValue(cr.Spec.IssuerRef.Kind, cr.Spec.IssuerRef.Name)}
+}
+
+// issuerBecameReady filters issuer updates to those that turn the issuer
+// Ready.
+func issuerBecameReady() predicate.Predicate {
+	return predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			_, oldStatus, err := issuerutil.GetSpecAndStatus(e.ObjectOld)
+			if err != nil {
+				return false
+			}
+			_, newStatus, err := issuerutil.GetSpecAndStatus(e.ObjectNew)
+			if err != nil {
+				return false
+			}
+			return !issuerutil.IsReady(oldStatus) && issuerutil.IsReady(newStatus)
+		},
+	}
+}
+
+// existingCertificate returns the certificate the CertificateRequest renews.
+// It is read from the Secret of the Certificate the request belongs to, the
+// private key Secret of the request only holds the next private key. It
+// returns nil if the request has no Certificate or the Certificate has not
+// been issued yet.
+func (r *CertificateRequestReconciler) existingCertificate(ctx context.Context, certificateRequest *cmapi.CertificateRequest) ([]byte, error) {
+	certificateName := certificateRequest.Annotations[cmapi.CertificateNameKey]
+	if certificateName == "" {
+		return nil, nil
+	}
+	var certificate cmapi.Certificate
+	if err := r.Get(ctx, types.NamespacedName{Name: certificateName, Namespace: certificateRequest.Namespace}, &certificate); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, types.NamespacedName{Name: certificate.Spec.SecretName, Namespace: certificateRequest.Namespace}, &secret); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	return secret.Data[corev1.TLSCertKey], nil
+}
+
+// ignoreOwnUpdates filters out updates of a CertificateRequest that only
+// change the pending state annotations or the Ready condition, which are
+// written by this reconciler. Otherwise storing a pending transaction would
+// poll the SCEP server again at once instead of after the poll interval.
+func ignoreOwnUpdates() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			oldCR, ok := e.ObjectOld.(*cmapi.CertificateRequest)
+			if !ok {
+				return true
+			}
+			newCR, ok := e.ObjectNew.(*cmapi.CertificateRequest)
+			if !ok {
+				return true
+			}
+			return !apiequality.Semantic.DeepEqual(withoutOwnFields(oldCR), withoutOwnFields(newCR))
+		},
+	}
+}
+
+// withoutOwnFields returns a copy of cr without the fields written by this
+// reconciler and the metadata every update changes.
+func withoutOwnFields(cr *cmapi.CertificateRequest) *cmapi.CertificateRequest {
+	cr = cr.DeepCopy()
+	cr.ResourceVersion = ""
+	cr.ManagedFields = nil
+	for key := range cr.Annotations {
+		if strings.HasPrefix(key, pendingStateAnnotationPrefix) {
+			delete(cr.Annotations, key)
+		}
+	}
+	conditions := cr.Status.Conditions[:0]
+	for _, condition := range cr.Status.Conditions {
+		if condition.Type != cmapi.CertificateRequestConditionReady {
+			conditions = append(conditions, condition)
+		}
+	}
+	cr.Status.Conditions = conditions
+	return cr
+}
+
+// certificateRequestsForIssuer maps an issuer to the CertificateRequests
+// which reference it and are neither Ready nor Failed, so that requests
+// which waited for the issuer are retried as soon as it becomes Ready.
+func (r *CertificateRequestReconciler) certificateRequestsForIssuer(issuer client.Object) []reconcile.Request {
+	var kind string
+	opts := []client.ListOption{}
+	switch issuer.(type) {
+	case *scepissuerapi.SCEPIssuer:
+		kind = "SCEPIssuer"
+		opts = append(opts, client.InNamespace(issuer.GetNamespace()))
+	case *scepissuerapi.SCEPClusterIssuer:
+		kind = "SCEPClusterIssuer"
+	default:
+		return nil
+	}
+	ref := issuerRefIndexValue(kind, issuer.GetName())
+	log := ctrl.Log.WithName("certificaterequest-issuer-watch").WithValues("issuerRef", ref)
+	opts = append(opts, client.MatchingFields{issuerRefField: ref})
+
+	var certificateRequests cmapi.CertificateRequestList
+	if err := r.List(context.Background(), &certificateRequests, opts...); err != nil {
+		log.Error(err, "Failed to list CertificateRequests")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for i := range certificateRequests.Items {
+		cr := &certificateRequests.Items[i]
+		if refs := indexIssuerRef(cr); len(refs) == 0 || refs[0] != ref {
+			continue
+		}
+		ready := cmutil.GetCertificateRequestCondition(cr, cmapi.CertificateRequestConditionReady)
+		if ready != nil && (ready.Status == cmmeta.ConditionTrue ||
+			ready.Reason == cmapi.CertificateRequestReasonFailed ||
+			ready.Reason == cmapi.CertificateRequestReasonDenied) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(cr)})
+	}
+	return requests
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *CertificateRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &cmapi.CertificateRequest{}, issuerRefField, indexIssuerRef); err != nil {
+		return err
+	}
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&cmapi.CertificateRequest{}).
+		For(&cmapi.CertificateRequest{}, builder.WithPredicates(ignoreOwnUpdates())).
+		Watches(
+			&source.Kind{Type: &scepissuerapi.SCEPIssuer{}},
+			handler.EnqueueRequestsFromMapFunc(r.certificateRequestsForIssuer),
+			builder.WithPredicates(issuerBecameReady()),
+		).
+		Watches(
+			&source.Kind{Type: &scepissuerapi.SCEPClusterIssuer{}},
+			handler.EnqueueRequestsFromMapFunc(r.certificateRequestsForIssuer),
+			builder.WithPredicates(issuerBecameReady()),
+		).
 		Complete(r)
 }
@@ -2,16 +2,29 @@ package controllers
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
+	"strings"
 	"testing"
 	"time"
 
 	cmutil "github.com/cert-manager/cert-manager/pkg/api/util"
 	cmapi "github.com/cert-manager/cert-manager/pkg/apis/certmanager/v1"
 	cmmeta "github.com/cert-manager/cert-manager/pkg/apis/meta/v1"
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
 	cmgen "github.com/cert-manager/cert-manager/test/unit/gen"
+	"github.com/go-logr/logr"
 	logrtesting "github.com/go-logr/logr/testing"
+	"github.com/micromdm/scep/v2/scep"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
@@ -20,14 +33,17 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/record"
 	clocktesting "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
 	"github.com/mheers/scep-external-issuer/issuer/signer"
+	issuerutil "github.com/mheers/scep-external-issuer/issuer/util"
 )
 
 var (
@@ -37,18 +53,42 @@ var (
 
 type fakeSigner struct {
 	errSign error
+	errPoll error
+	signed  *signer.SignedCertificate
 }
 
-func (o *fakeSigner) SignWithPrivateKey([]byte, *rsa.PrivateKey) ([]byte, error) {
-	return []byte("fake signed certificate"), o.errSign
+func (o *fakeSigner) SignWithPrivateKey(context.Context, []byte, crypto.Signer, string) (*signer.SignedCertificate, error) {
+	return o.signedCertificate("fake signed certificate"), o.errSign
 }
-func (o *fakeSigner) Sign([]byte) ([]byte, error) {
-	return []byte("fake signed certificate"), o.errSign
+func (o *fakeSigner) RenewWithPrivateKey(context.Context, []byte, crypto.Signer, []byte, string) (*signer.SignedCertificate, error) {
+	return o.signedCertificate("fake renewed certificate"), o.errSign
+}
+func (o *fakeSigner) PollWithPrivateKey(context.Context, []byte, crypto.Signer, *signer.PendingState) (*signer.SignedCertificate, error) {
+	return o.signedCertificate("fake polled certificate"), o.errPoll
+}
+func (o *fakeSigner) Sign(context.Context, []byte, string) (*signer.SignedCertificate, error) {
+	return o.signedCertificate("fake keyless certificate"), o.errSign
+}
+func (o *fakeSigner) signedCertificate(certificate string) *signer.SignedCertificate {
+	if o.signed != nil {
+		return o.signed
+	}
+	return &signer.SignedCertificate{Certificate: []byte(certificate)}
 }
 
 func TestCertificateRequestReconcile(t *testing.T) {
 	nowMetaTime := metav1.NewTime(fixedClockStart)
 
+	pendingState := signer.PendingState{
+		TransactionID:     "tid1",
+		SignerCertificate: []byte("fake signer certificate"),
+	}
+	pendingAnnotations := map[string]string{
+		transactionIDAnnotation:     "tid1",
+		signerCertificateAnnotation: "fake signer certificate",
+		pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+	}
+
 	type testCase struct {
 		name                         types.NamespacedName
 		objects                      []client.Object
@@ -60,6 +100,10 @@ func TestCertificateRequestReconcile(t *testing.T) {
 		expectedReadyConditionReason string
 		expectedFailureTime          *metav1.Time
 		expectedCertificate          []byte
+		expectedCA                   []byte
+		expectedAnnotations          map[string]string
+		expectedEvents               []string
+		expectNoUpdate               bool
 	}
 	tests := map[string]testCase{
 		"success-issuer": {
@@ -68,10 +112,12 @@ func TestCertificateRequestReconcile(t *testing.T) {
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -108,25 +154,32 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Namespace: "ns1",
 					},
 				},
+				privateKeySecret("ns1"),
 			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
 				return &fakeSigner{}, nil
 			},
 			expectedReadyConditionStatus: cmmeta.ConditionTrue,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
 			expectedFailureTime:          nil,
 			expectedCertificate:          []byte("fake signed certificate"),
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				"Normal Issued The SCEP server answered SUCCESS",
+			},
 		},
-		"success-cluster-issuer": {
+		"success-ecdsa-key": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(ecdsaCSRPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "clusterissuer1",
+						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "ClusterIssuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -137,15 +190,17 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Status: cmmeta.ConditionUnknown,
 					}),
 				),
-				&scepissuerapi.SCEPClusterIssuer{
+				&scepissuerapi.SCEPIssuer{
 					ObjectMeta: metav1.ObjectMeta{
-						Name: "clusterissuer1",
+						Name:      "issuer1",
+						Namespace: "ns1",
 					},
 					Spec: scepissuerapi.SCEPIssuerSpec{
-						AuthSecretName: "clusterissuer1-credentials",
+						AuthSecretName: "issuer1-credentials",
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -157,162 +212,39 @@ func TestCertificateRequestReconcile(t *testing.T) {
 				},
 				&corev1.Secret{
 					ObjectMeta: metav1.ObjectMeta{
-						Name:      "clusterissuer1-credentials",
-						Namespace: "kube-system",
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": ecdsaPrivateKeyPEM,
 					},
 				},
 			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
 				return &fakeSigner{}, nil
 			},
-			clusterResourceNamespace:     "kube-system",
 			expectedReadyConditionStatus: cmmeta.ConditionTrue,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
 			expectedFailureTime:          nil,
 			expectedCertificate:          []byte("fake signed certificate"),
 		},
-		"certificaterequest-not-found": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-		},
-		"issuer-ref-foreign-group": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "issuer1",
-						Group: "foreign-issuer.example.com",
-					}),
-				),
-			},
-		},
-		"certificaterequest-already-ready": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "issuer1",
-						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionApproved,
-						Status: cmmeta.ConditionTrue,
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionReady,
-						Status: cmmeta.ConditionTrue,
-					}),
-				),
-			},
-		},
-		"certificaterequest-missing-ready-condition": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "issuer1",
-						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionApproved,
-						Status: cmmeta.ConditionTrue,
-					}),
-				),
-			},
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
-		},
-		"issuer-ref-unknown-kind": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "issuer1",
-						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "ForeignKind",
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionApproved,
-						Status: cmmeta.ConditionTrue,
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionReady,
-						Status: cmmeta.ConditionUnknown,
-					}),
-				),
-			},
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
-		},
-		"issuer-not-found": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "issuer1",
-						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionApproved,
-						Status: cmmeta.ConditionTrue,
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionReady,
-						Status: cmmeta.ConditionUnknown,
-					}),
-				),
-			},
-			expectedError:                errGetIssuer,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
-		},
-		"clusterissuer-not-found": {
-			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
-			objects: []client.Object{
-				cmgen.CertificateRequest(
-					"cr1",
-					cmgen.SetCertificateRequestNamespace("ns1"),
-					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
-						Name:  "clusterissuer1",
-						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "ClusterIssuer",
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionApproved,
-						Status: cmmeta.ConditionTrue,
-					}),
-					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionReady,
-						Status: cmmeta.ConditionUnknown,
-					}),
-				),
-			},
-			expectedError:                errGetIssuer,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
-		},
-		"issuer-not-ready": {
+		"success-keyless-without-private-key-annotation": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestCSR(ecdsaCSRPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -328,32 +260,52 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Name:      "issuer1",
 						Namespace: "ns1",
 					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
-									Status: scepissuerapi.ConditionFalse,
+									Status: scepissuerapi.ConditionTrue,
 								},
 							},
 						},
 					},
 				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake keyless certificate"),
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending keyless enrollment request to the SCEP server",
+				"Normal Issued The SCEP server answered SUCCESS",
 			},
-			expectedError:                errIssuerNotReady,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
 		},
-		"issuer-secret-not-found": {
+		"success-keyless-issuer": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(ecdsaCSRPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -371,9 +323,11 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 					Spec: scepissuerapi.SCEPIssuerSpec{
 						AuthSecretName: "issuer1-credentials",
+						Keyless:        true,
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -383,21 +337,33 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						},
 					},
 				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
 			},
-			expectedError:                errGetAuthSecret,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake keyless certificate"),
 		},
-		"signer-builder-error": {
+		"success-pkcs1-rsa-key": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(pkcs1CSRPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -418,6 +384,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -433,24 +400,36 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Namespace: "ns1",
 					},
 				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": pkcs1PrivateKeyPEM,
+					},
+				},
 			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
-				return nil, errors.New("simulated signer builder error")
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
 			},
-			expectedError:                errSignerBuilder,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
 		},
-		"signer-error": {
+		"success-sec1-ecdsa-key": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(sec1CSRPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionApproved,
@@ -471,6 +450,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -486,24 +466,40 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Namespace: "ns1",
 					},
 				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": sec1PrivateKeyPEM,
+					},
+				},
 			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
-				return &fakeSigner{errSign: errors.New("simulated sign error")}, nil
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
 			},
-			expectedError:                errSignerSign,
-			expectedReadyConditionStatus: cmmeta.ConditionFalse,
-			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
 		},
-		"request-not-approved": {
+		"private-key-malformed": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
 						Type:   cmapi.CertificateRequestConditionReady,
@@ -520,6 +516,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -535,26 +532,39 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Namespace: "ns1",
 					},
 				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": []byte("not a private key"),
+					},
+				},
 			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
 				return &fakeSigner{}, nil
 			},
-			expectedFailureTime: nil,
-			expectedCertificate: nil,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+			expectedCertificate:          nil,
 		},
-		"request-denied": {
+		"private-key-missing": {
 			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
 			objects: []client.Object{
 				cmgen.CertificateRequest(
 					"cr1",
 					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
 					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
 						Name:  "issuer1",
 						Group: scepissuerapi.GroupVersion.Group,
-						Kind:  "Issuer",
+						Kind:  "SCEPIssuer",
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
-						Type:   cmapi.CertificateRequestConditionDenied,
+						Type:   cmapi.CertificateRequestConditionApproved,
 						Status: cmmeta.ConditionTrue,
 					}),
 					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
@@ -572,6 +582,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					},
 					Status: scepissuerapi.SCEPIssuerStatus{
 						Status: scepissuerapi.Status{
+
 							Conditions: []scepissuerapi.Condition{
 								{
 									Type:   scepissuerapi.IssuerConditionReady,
@@ -587,11 +598,1479 @@ func TestCertificateRequestReconcile(t *testing.T) {
 						Namespace: "ns1",
 					},
 				},
-			},
-			signerBuilder: func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (signer.Signer, error) {
-				return &fakeSigner{}, nil
-			},
-			expectedCertificate:          nil,
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": nil,
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+			expectedCertificate:          nil,
+		},
+		"private-key-mismatch": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cr1-private-key",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": ecdsaPrivateKeyPEM,
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+			expectedCertificate:          nil,
+		},
+		"success-cluster-issuer": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "clusterissuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPClusterIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			clusterResourceNamespace:     "kube-system",
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
+		},
+		"cluster-issuer-private-key-in-cluster-resource-namespace": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "clusterissuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPClusterIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+				privateKeySecret("kube-system"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			clusterResourceNamespace:     "kube-system",
+			expectedError:                errGetPrivateKey,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"success-ca-chain": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					signed: &signer.SignedCertificate{
+						Certificate: leafPEM,
+						CAChain:     append(append([]byte{}, intermediatePEM...), rootPEM...),
+					},
+				}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          append(append([]byte{}, leafPEM...), intermediatePEM...),
+			expectedCA:                   rootPEM,
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				fmt.Sprintf("Normal Issued The SCEP server answered SUCCESS, serial number: %x", leafSerialNumber),
+			},
+		},
+		"success-renewal": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.AddCertificateRequestAnnotations(certificateNameAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+				cmgen.Certificate(
+					"cert1",
+					cmgen.SetCertificateNamespace("ns1"),
+					cmgen.SetCertificateSecretName("cert1-tls"),
+				),
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "cert1-tls",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"tls.key": privateKeyPEM,
+						"tls.crt": []byte("fake existing certificate"),
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake renewed certificate"),
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending renewal request to the SCEP server",
+				"Normal Issued The SCEP server answered SUCCESS",
+			},
+		},
+		"success-first-issuance-of-certificate": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.AddCertificateRequestAnnotations(certificateNameAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+				cmgen.Certificate(
+					"cert1",
+					cmgen.SetCertificateNamespace("ns1"),
+					cmgen.SetCertificateSecretName("cert1-tls"),
+				),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedFailureTime:          nil,
+			expectedCertificate:          []byte("fake signed certificate"),
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				"Normal Issued The SCEP server answered SUCCESS",
+			},
+		},
+		"certificaterequest-not-found": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+		},
+		"issuer-ref-foreign-group": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: "foreign-issuer.example.com",
+					}),
+				),
+			},
+		},
+		"certificaterequest-already-ready": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionTrue,
+					}),
+				),
+			},
+		},
+		"certificaterequest-missing-ready-condition": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+				),
+			},
+			expectedResult:               ctrl.Result{Requeue: true},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"issuer-ref-unknown-kind": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "ForeignKind",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+		},
+		"issuer-not-found": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+			},
+			expectedError:                errGetIssuer,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"clusterissuer-not-found": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "clusterissuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPClusterIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+			},
+			expectedError:                errGetIssuer,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"issuer-not-ready": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionFalse,
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedError:                errIssuerNotReady,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedEvents:               []string{},
+		},
+		"issuer-secret-not-found": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedError:                errGetAuthSecret,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"issuer-client-certificate-secret-not-found": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+						TLS: &scepissuerapi.TLSConfig{
+							ClientCertificateSecretName: "issuer1-client-certificate",
+						},
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			expectedError:                errGetClientCertificate,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"signer-builder-error": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return nil, errors.New("simulated signer builder error")
+			},
+			expectedError:                errSignerBuilder,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"signer-error": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: errors.New("simulated sign error")}, nil
+			},
+			expectedError:                errSignerSign,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+		},
+		"signer-failure-permanent": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: &signer.FailureError{MessageType: scep.PKCSReq, FailInfo: scep.BadRequest}}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				"Warning Failed The SCEP server answered FAILURE, failInfo: badRequest (2)",
+			},
+		},
+		"signer-failure-bad-time": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: &signer.FailureError{MessageType: scep.PKCSReq, FailInfo: scep.BadTime}}, nil
+			},
+			expectedError:                errSignerSign,
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				"Warning EnrollmentRejected The SCEP server answered FAILURE, failInfo: badTime (3), retrying",
+			},
+		},
+		"signer-pending": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: &signer.PendingError{State: pendingState}}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultPendingPollInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedAnnotations:          pendingAnnotations,
+			expectedEvents: []string{
+				"Normal EnrollmentSent Sending enrollment request to the SCEP server",
+				"Normal Pending The SCEP server answered PENDING, transactionID: tid1, polling again in 30s",
+			},
+		},
+		"poll-pending-request": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{errSign: errors.New("unexpected new enrollment")}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionTrue,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonIssued,
+			expectedCertificate:          []byte("fake polled certificate"),
+			expectedEvents: []string{
+				"Normal EnrollmentSent Polling the SCEP server for the pending request, transactionID: tid1",
+				"Normal Issued The SCEP server answered SUCCESS",
+			},
+		},
+		"poll-still-pending": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					errSign: errors.New("unexpected new enrollment"),
+					errPoll: &signer.PendingError{State: pendingState},
+				}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultPendingPollInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedAnnotations: map[string]string{
+				transactionIDAnnotation:     "tid1",
+				signerCertificateAnnotation: "fake signer certificate",
+				pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+			},
+			// a poll answered with PENDING does not change the annotations
+			expectNoUpdate: true,
+		},
+		"poll-still-pending-custom-interval": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName:      "issuer1-credentials",
+						PendingPollInterval: &metav1.Duration{Duration: 5 * time.Minute},
+						MaxPendingDuration:  &metav1.Duration{Duration: time.Hour},
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					errSign: errors.New("unexpected new enrollment"),
+					errPoll: &signer.PendingError{State: pendingState},
+				}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: 5 * time.Minute},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedAnnotations: map[string]string{
+				transactionIDAnnotation:     "tid1",
+				signerCertificateAnnotation: "fake signer certificate",
+				pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+			},
+			// a poll answered with PENDING does not change the annotations
+			expectNoUpdate: true,
+		},
+		"poll-still-pending-zero-interval": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName:      "issuer1-credentials",
+						PendingPollInterval: &metav1.Duration{},
+						MaxPendingDuration:  &metav1.Duration{Duration: time.Hour},
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					errSign: errors.New("unexpected new enrollment"),
+					errPoll: &signer.PendingError{State: pendingState},
+				}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultPendingPollInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedAnnotations: map[string]string{
+				transactionIDAnnotation:     "tid1",
+				signerCertificateAnnotation: "fake signer certificate",
+				pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+			},
+			// a poll answered with PENDING does not change the annotations
+			expectNoUpdate: true,
+		},
+		"poll-still-pending-zero-max-pending-duration": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName:     "issuer1-credentials",
+						MaxPendingDuration: &metav1.Duration{},
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					errSign: errors.New("unexpected new enrollment"),
+					errPoll: &signer.PendingError{State: pendingState},
+				}, nil
+			},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultPendingPollInterval},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonPending,
+			expectedAnnotations: map[string]string{
+				transactionIDAnnotation:     "tid1",
+				signerCertificateAnnotation: "fake signer certificate",
+				pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+			},
+			// a poll answered with PENDING does not change the annotations
+			expectNoUpdate: true,
+		},
+		"poll-pending-timeout": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+					cmgen.SetCertificateRequestCSR(csrPEM),
+					cmgen.AddCertificateRequestAnnotations(pendingAnnotations),
+					cmgen.AddCertificateRequestAnnotations(map[string]string{
+						pendingSinceAnnotation: fixedClockStart.Add(-2 * time.Hour).Format(time.RFC3339),
+					}),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionApproved,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName:     "issuer1-credentials",
+						MaxPendingDuration: &metav1.Duration{Duration: time.Hour},
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+				privateKeySecret("ns1"),
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{
+					errSign: errors.New("unexpected new enrollment"),
+					errPoll: &signer.PendingError{State: pendingState},
+				}, nil
+			},
+			expectedReadyConditionStatus: cmmeta.ConditionFalse,
+			expectedReadyConditionReason: cmapi.CertificateRequestReasonFailed,
+			expectedFailureTime:          &nowMetaTime,
+			expectedEvents: []string{
+				"Normal EnrollmentSent Polling the SCEP server for the pending request, transactionID: tid1",
+				"Warning Failed the SCEP server did not decide on the request in time",
+			},
+		},
+		"request-not-approved": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedFailureTime: nil,
+			expectedCertificate: nil,
+		},
+		"request-denied": {
+			name: types.NamespacedName{Namespace: "ns1", Name: "cr1"},
+			objects: []client.Object{
+				cmgen.CertificateRequest(
+					"cr1",
+					cmgen.SetCertificateRequestNamespace("ns1"),
+					cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+						Name:  "issuer1",
+						Group: scepissuerapi.GroupVersion.Group,
+						Kind:  "SCEPIssuer",
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionDenied,
+						Status: cmmeta.ConditionTrue,
+					}),
+					cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+						Type:   cmapi.CertificateRequestConditionReady,
+						Status: cmmeta.ConditionUnknown,
+					}),
+				),
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: scepissuerapi.SCEPIssuerStatus{
+						Status: scepissuerapi.Status{
+							Conditions: []scepissuerapi.Condition{
+								{
+									Type:   scepissuerapi.IssuerConditionReady,
+									Status: scepissuerapi.ConditionTrue,
+								},
+							},
+						},
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			signerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+				return &fakeSigner{}, nil
+			},
+			expectedCertificate:          nil,
 			expectedFailureTime:          &nowMetaTime,
 			expectedReadyConditionStatus: cmmeta.ConditionFalse,
 			expectedReadyConditionReason: cmapi.CertificateRequestReasonDenied,
@@ -605,10 +2084,10 @@ func TestCertificateRequestReconcile(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			fakeClient := fake.NewClientBuilder().
+			fakeClient := &updateCountingClient{Client: fake.NewClientBuilder().
 				WithScheme(scheme).
 				WithObjects(tc.objects...).
-				Build()
+				Build()}
 			controller := CertificateRequestReconciler{
 				Client:                   fakeClient,
 				Scheme:                   scheme,
@@ -616,6 +2095,7 @@ func TestCertificateRequestReconcile(t *testing.T) {
 				SignerBuilder:            tc.signerBuilder,
 				CheckApprovedCondition:   true,
 				Clock:                    fixedClock,
+				Recorder:                 record.NewFakeRecorder(10),
 			}
 			result, err := controller.Reconcile(
 				ctrl.LoggerInto(context.TODO(), logrtesting.NewTestLogger(t)),
@@ -637,13 +2117,466 @@ func TestCertificateRequestReconcile(t *testing.T) {
 					assertCertificateRequestHasReadyCondition(t, tc.expectedReadyConditionStatus, tc.expectedReadyConditionReason, &cr)
 				}
 				assert.Equal(t, tc.expectedCertificate, cr.Status.Certificate)
+				assert.Equal(t, tc.expectedCA, cr.Status.CA)
+				for key, value := range tc.expectedAnnotations {
+					assert.Equal(t, value, cr.Annotations[key], "unexpected annotation %s", key)
+				}
 
 				if !apiequality.Semantic.DeepEqual(tc.expectedFailureTime, cr.Status.FailureTime) {
 					assert.Equal(t, tc.expectedFailureTime, cr.Status.FailureTime)
 				}
+				assertIssuerLastIssuanceTime(t, fakeClient, &cr, tc.expectedReadyConditionReason == cmapi.CertificateRequestReasonIssued)
+			}
+			if tc.expectedEvents != nil {
+				assertEvents(t, controller.Recorder.(*record.FakeRecorder), tc.expectedEvents)
+			}
+			if tc.expectNoUpdate {
+				assert.Zero(t, fakeClient.updates, "unexpected update of the CertificateRequest")
+			}
+		})
+	}
+}
+
+// updateCountingClient counts the updates of objects, not of their status.
+type updateCountingClient struct {
+	client.Client
+	updates int
+}
+
+func (c *updateCountingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.updates++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+// TestCertificateRequestReconcileInitialiseThenSign checks that a new
+// CertificateRequest is signed although ignoreOwnUpdates filters the update
+// which initialises its Ready condition.
+func TestCertificateRequestReconcileInitialiseThenSign(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, scepissuerapi.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	name := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(
+			cmgen.CertificateRequest(
+				"cr1",
+				cmgen.SetCertificateRequestNamespace("ns1"),
+				cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+				cmgen.SetCertificateRequestCSR(csrPEM),
+				cmgen.SetCertificateRequestIssuer(cmmeta.ObjectReference{
+					Name:  "issuer1",
+					Group: scepissuerapi.GroupVersion.Group,
+					Kind:  "SCEPIssuer",
+				}),
+				cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+					Type:   cmapi.CertificateRequestConditionApproved,
+					Status: cmmeta.ConditionTrue,
+				}),
+			),
+			&scepissuerapi.SCEPIssuer{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "issuer1",
+					Namespace: "ns1",
+				},
+				Spec: scepissuerapi.SCEPIssuerSpec{
+					AuthSecretName: "issuer1-credentials",
+				},
+				Status: scepissuerapi.SCEPIssuerStatus{
+					Status: scepissuerapi.Status{
+						Conditions: []scepissuerapi.Condition{
+							{
+								Type:   scepissuerapi.IssuerConditionReady,
+								Status: scepissuerapi.ConditionTrue,
+							},
+						},
+					},
+				},
+			},
+			&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "issuer1-credentials",
+					Namespace: "ns1",
+				},
+			},
+			privateKeySecret("ns1"),
+		).
+		Build()
+	controller := CertificateRequestReconciler{
+		Client: fakeClient,
+		Scheme: scheme,
+		SignerBuilder: func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (signer.Signer, error) {
+			return &fakeSigner{}, nil
+		},
+		CheckApprovedCondition: true,
+		Clock:                  fixedClock,
+		Recorder:               record.NewFakeRecorder(10),
+	}
+	ctx := ctrl.LoggerInto(context.TODO(), logrtesting.NewTestLogger(t))
+
+	var initial cmapi.CertificateRequest
+	require.NoError(t, fakeClient.Get(context.TODO(), name, &initial))
+	result, err := controller.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{Requeue: true}, result, "the initialisation has to requeue the request")
+
+	var initialised cmapi.CertificateRequest
+	require.NoError(t, fakeClient.Get(context.TODO(), name, &initialised))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionFalse, cmapi.CertificateRequestReasonPending, &initialised)
+	assert.False(t, ignoreOwnUpdates().Update(event.UpdateEvent{ObjectOld: &initial, ObjectNew: &initialised}),
+		"the initialisation is expected to be filtered, so it cannot trigger the next reconcile")
+
+	result, err = controller.Reconcile(ctx, reconcile.Request{NamespacedName: name})
+	require.NoError(t, err)
+	assert.Equal(t, ctrl.Result{}, result)
+
+	var signed cmapi.CertificateRequest
+	require.NoError(t, fakeClient.Get(context.TODO(), name, &signed))
+	assertCertificateRequestHasReadyCondition(t, cmmeta.ConditionTrue, cmapi.CertificateRequestReasonIssued, &signed)
+	assert.Equal(t, []byte("fake signed certificate"), signed.Status.Certificate)
+}
+
+var (
+	privateKeyAnnotations = map[string]string{
+		"cert-manager.io/private-key-secret-name": "cr1-private-key",
+	}
+	certificateNameAnnotations = map[string]string{
+		"cert-manager.io/certificate-name": "cert1",
+	}
+	privateKeyPEM, csrPEM             = privateKeyAndCSR(newRSAKey())
+	ecdsaPrivateKeyPEM, ecdsaCSRPEM   = privateKeyAndCSR(newECDSAKey())
+	pkcs1PrivateKeyPEM, pkcs1CSRPEM   = legacyPrivateKeyAndCSR(newRSAKey())
+	sec1PrivateKeyPEM, sec1CSRPEM     = legacyPrivateKeyAndCSR(newECDSAKey())
+	rootPEM, intermediatePEM, leafPEM = certificateChain()
+	leafSerialNumber                  = mustDecodeCertificate(leafPEM).SerialNumber
+)
+
+func mustDecodeCertificate(certPEM []byte) *x509.Certificate {
+	cert, err := pki.DecodeX509CertificateBytes(certPEM)
+	if err != nil {
+		panic(err)
+	}
+	return cert
+}
+
+func TestCertificateRequestsForIssuer(t *testing.T) {
+	cr := func(namespace, name string, ref cmmeta.ObjectReference, conditions ...cmapi.CertificateRequestCondition) *cmapi.CertificateRequest {
+		mods := []cmgen.CertificateRequestModifier{
+			cmgen.SetCertificateRequestNamespace(namespace),
+			cmgen.SetCertificateRequestIssuer(ref),
+		}
+		for _, c := range conditions {
+			mods = append(mods, cmgen.SetCertificateRequestStatusCondition(c))
+		}
+		return cmgen.CertificateRequest(name, mods...)
+	}
+	issuerRef := cmmeta.ObjectReference{Name: "issuer1", Group: scepissuerapi.GroupVersion.Group, Kind: "SCEPIssuer"}
+	clusterIssuerRef := cmmeta.ObjectReference{Name: "issuer1", Group: scepissuerapi.GroupVersion.Group, Kind: "SCEPClusterIssuer"}
+	pending := cmapi.CertificateRequestCondition{
+		Type:   cmapi.CertificateRequestConditionReady,
+		Status: cmmeta.ConditionFalse,
+		Reason: cmapi.CertificateRequestReasonPending,
+	}
+	objects := []client.Object{
+		cr("ns1", "pending", issuerRef, pending),
+		cr("ns1", "new", issuerRef),
+		cr("ns1", "ready", issuerRef, cmapi.CertificateRequestCondition{
+			Type:   cmapi.CertificateRequestConditionReady,
+			Status: cmmeta.ConditionTrue,
+			Reason: cmapi.CertificateRequestReasonIssued,
+		}),
+		cr("ns1", "failed", issuerRef, cmapi.CertificateRequestCondition{
+			Type:   cmapi.CertificateRequestConditionReady,
+			Status: cmmeta.ConditionFalse,
+			Reason: cmapi.CertificateRequestReasonFailed,
+		}),
+		cr("ns1", "other-issuer", cmmeta.ObjectReference{Name: "issuer2", Group: scepissuerapi.GroupVersion.Group, Kind: "SCEPIssuer"}, pending),
+		cr("ns1", "foreign-group", cmmeta.ObjectReference{Name: "issuer1", Group: "foreign-issuer.example.com", Kind: "SCEPIssuer"}, pending),
+		cr("ns2", "other-namespace", issuerRef, pending),
+		cr("ns1", "cluster-pending", clusterIssuerRef, pending),
+		cr("ns2", "cluster-pending", clusterIssuerRef, pending),
+	}
+
+	tests := map[string]struct {
+		issuer           client.Object
+		expectedRequests []reconcile.Request
+	}{
+		"issuer": {
+			issuer: &scepissuerapi.SCEPIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "issuer1"}},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "pending"}},
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "new"}},
+			},
+		},
+		"cluster-issuer": {
+			issuer: &scepissuerapi.SCEPClusterIssuer{ObjectMeta: metav1.ObjectMeta{Name: "issuer1"}},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "cluster-pending"}},
+				{NamespacedName: types.NamespacedName{Namespace: "ns2", Name: "cluster-pending"}},
+			},
+		},
+		"unreferenced-issuer": {
+			issuer: &scepissuerapi.SCEPIssuer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "issuer3"}},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, scepissuerapi.AddToScheme(scheme))
+	require.NoError(t, cmapi.AddToScheme(scheme))
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objects...).
+				Build()
+			controller := CertificateRequestReconciler{
+				Client: fakeClient,
+				Scheme: scheme,
 			}
+			requests := controller.certificateRequestsForIssuer(tc.issuer)
+			assert.ElementsMatch(t, tc.expectedRequests, requests)
+		})
+	}
+}
+
+func TestEnrollmentOutcome(t *testing.T) {
+	tests := map[string]struct {
+		err              error
+		expectedOutcome  string
+		expectedFailInfo string
+	}{
+		"issued":  {expectedOutcome: "issued"},
+		"pending": {err: &signer.PendingError{State: signer.PendingState{TransactionID: "tid1"}}, expectedOutcome: "pending"},
+		"failed": {
+			err:              fmt.Errorf("wrapped: %w", &signer.FailureError{MessageType: scep.PKCSReq, FailInfo: scep.BadRequest}),
+			expectedOutcome:  "failed",
+			expectedFailInfo: "badRequest",
+		},
+		"error": {err: errors.New("connection refused"), expectedOutcome: "error"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			outcome, failInfo := enrollmentOutcome(tc.err)
+			assert.Equal(t, tc.expectedOutcome, outcome)
+			assert.Equal(t, tc.expectedFailInfo, failInfo)
+		})
+	}
+}
+
+func TestIssuerBecameReady(t *testing.T) {
+	issuer := func(status scepissuerapi.ConditionStatus) *scepissuerapi.SCEPIssuer {
+		i := &scepissuerapi.SCEPIssuer{}
+		issuerutil.SetReadyCondition(&i.Status, status, issuerReadyConditionReason, "")
+		return i
+	}
+
+	tests := map[string]struct {
+		old, new *scepissuerapi.SCEPIssuer
+		expected bool
+	}{
+		"not-ready-to-ready":     {old: issuer(scepissuerapi.ConditionFalse), new: issuer(scepissuerapi.ConditionTrue), expected: true},
+		"unknown-to-ready":       {old: issuer(scepissuerapi.ConditionUnknown), new: issuer(scepissuerapi.ConditionTrue), expected: true},
+		"no-condition-to-ready":  {old: &scepissuerapi.SCEPIssuer{}, new: issuer(scepissuerapi.ConditionTrue), expected: true},
+		"ready-to-ready":         {old: issuer(scepissuerapi.ConditionTrue), new: issuer(scepissuerapi.ConditionTrue)},
+		"ready-to-not-ready":     {old: issuer(scepissuerapi.ConditionTrue), new: issuer(scepissuerapi.ConditionFalse)},
+		"not-ready-to-not-ready": {old: issuer(scepissuerapi.ConditionFalse), new: issuer(scepissuerapi.ConditionFalse)},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, issuerBecameReady().Update(event.UpdateEvent{ObjectOld: tc.old, ObjectNew: tc.new}))
+		})
+	}
+	assert.False(t, issuerBecameReady().Create(event.CreateEvent{Object: issuer(scepissuerapi.ConditionTrue)}))
+}
+
+func TestIgnoreOwnUpdates(t *testing.T) {
+	cr := func(mods ...cmgen.CertificateRequestModifier) *cmapi.CertificateRequest {
+		mods = append([]cmgen.CertificateRequestModifier{
+			cmgen.SetCertificateRequestNamespace("ns1"),
+			cmgen.AddCertificateRequestAnnotations(privateKeyAnnotations),
+			cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+				Type:   cmapi.CertificateRequestConditionReady,
+				Status: cmmeta.ConditionUnknown,
+			}),
+		}, mods...)
+		return cmgen.CertificateRequest("cr1", mods...)
+	}
+	pending := cmgen.AddCertificateRequestAnnotations(map[string]string{
+		transactionIDAnnotation:     "tid1",
+		signerCertificateAnnotation: "fake signer certificate",
+		pendingSinceAnnotation:      fixedClockStart.Format(time.RFC3339),
+	})
+	readyPending := cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+		Type:   cmapi.CertificateRequestConditionReady,
+		Status: cmmeta.ConditionFalse,
+		Reason: cmapi.CertificateRequestReasonPending,
+	})
+	approved := cmgen.SetCertificateRequestStatusCondition(cmapi.CertificateRequestCondition{
+		Type:   cmapi.CertificateRequestConditionApproved,
+		Status: cmmeta.ConditionTrue,
+	})
+
+	tests := map[string]struct {
+		old, new *cmapi.CertificateRequest
+		expected bool
+	}{
+		"pending-state-stored":   {old: cr(), new: cr(pending)},
+		"ready-condition-set":    {old: cr(pending), new: cr(pending, readyPending)},
+		"resource-version-only":  {old: cr(pending), new: cr(pending, func(cr *cmapi.CertificateRequest) { cr.ResourceVersion = "2" })},
+		"approved":               {old: cr(pending, readyPending), new: cr(pending, readyPending, approved), expected: true},
+		"other-annotation-added": {old: cr(), new: cr(cmgen.AddCertificateRequestAnnotations(map[string]string{"example.com/other": "value"})), expected: true},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ignoreOwnUpdates().Update(event.UpdateEvent{ObjectOld: tc.old, ObjectNew: tc.new}))
 		})
 	}
+	assert.True(t, ignoreOwnUpdates().Create(event.CreateEvent{Object: cr()}))
+}
+
+// certificateChain returns a PEM encoded root CA, an intermediate CA issued by
+// the root and a leaf certificate issued by the intermediate.
+func certificateChain() (root, intermediate, leaf []byte) {
+	var parent *x509.Certificate
+	var parentKey *rsa.PrivateKey
+	var certs [][]byte
+	for i, name := range []string{"root", "intermediate", "leaf"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(int64(i + 1)),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             fixedClockStart,
+			NotAfter:              fixedClockStart.Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  name != "leaf",
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+		if err != nil {
+			panic(err)
+		}
+		if parent, err = x509.ParseCertificate(der); err != nil {
+			panic(err)
+		}
+		parentKey = key
+		certs = append(certs, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	return certs[0], certs[1], certs[2]
+}
+
+func newRSAKey() crypto.Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func newECDSAKey() crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// privateKeyAndCSR returns a PEM encoded PKCS#8 private key and a CSR for it
+func privateKeyAndCSR(key crypto.Signer) ([]byte, []byte) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "cr1"},
+	}, key)
+	if err != nil {
+		panic(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+}
+
+// legacyPrivateKeyAndCSR returns a PEM encoded PKCS#1 RSA or SEC1 EC private
+// key and a CSR for it
+func legacyPrivateKeyAndCSR(key crypto.Signer) ([]byte, []byte) {
+	_, csrPEM := privateKeyAndCSR(key)
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(k)}), csrPEM
+	case *ecdsa.PrivateKey:
+		der, err := x509.MarshalECPrivateKey(k)
+		if err != nil {
+			panic(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), csrPEM
+	}
+	panic(fmt.Sprintf("unsupported key type %T", key))
+}
+
+func privateKeySecret(namespace string) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cr1-private-key",
+			Namespace: namespace,
+		},
+		Data: map[string][]byte{
+			"tls.key": privateKeyPEM,
+		},
+	}
+}
+
+// assertIssuerLastIssuanceTime checks that the issuer of cr records an
+// issuance at the fixed clock time if issued is set, and none otherwise.
+func assertIssuerLastIssuanceTime(t *testing.T, c client.Client, cr *cmapi.CertificateRequest, issued bool) {
+	var issuer client.Object
+	name := types.NamespacedName{Name: cr.Spec.IssuerRef.Name}
+	switch cr.Spec.IssuerRef.Kind {
+	case "SCEPIssuer":
+		issuer = &scepissuerapi.SCEPIssuer{}
+		name.Namespace = cr.Namespace
+	case "SCEPClusterIssuer":
+		issuer = &scepissuerapi.SCEPClusterIssuer{}
+	default:
+		return
+	}
+	if err := c.Get(context.TODO(), name, issuer); err != nil {
+		require.NoError(t, client.IgnoreNotFound(err))
+		return
+	}
+	_, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
+	require.NoError(t, err)
+	if !issued {
+		assert.Nil(t, issuerStatus.LastIssuanceTime)
+		return
+	}
+	if assert.NotNil(t, issuerStatus.LastIssuanceTime) {
+		assert.True(t, issuerStatus.LastIssuanceTime.Time.Equal(fixedClockStart))
+	}
+}
+
+// assertEvents checks that the recorded Events start with the expected ones
+// in order. Transaction IDs derived from the UID are not part of the
+// expectations.
+func assertEvents(t *testing.T, recorder *record.FakeRecorder, expected []string) {
+	t.Helper()
+	close(recorder.Events)
+	var events []string
+	for event := range recorder.Events {
+		events = append(events, event)
+	}
+	if assert.Len(t, events, len(expected), "unexpected events %v", events) {
+		for i, prefix := range expected {
+			assert.True(t, strings.HasPrefix(events[i], prefix), "event %q does not start with %q", events[i], prefix)
+		}
+	}
 }
 
 func assertErrorIs(t *testing.T, expectedError, actualError error) {
@@ -23,42 +23,79 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	scepissuer "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/mheers/scep-external-issuer/issuer/metrics"
 	signer "github.com/mheers/scep-external-issuer/issuer/signer"
 	issuerutil "github.com/mheers/scep-external-issuer/issuer/util"
 )
 
 const (
 	issuerReadyConditionReason = "spec-issuer.IssuerController.Reconcile"
+	// issuerUnsupportedAlgorithmReason is the Ready condition reason if the
+	// SCEP server does not advertise an algorithm configured on the issuer
+	issuerUnsupportedAlgorithmReason = "UnsupportedAlgorithm"
+	// issuerCAFingerprintMismatchReason is the Ready condition reason if the
+	// CA certificates of the SCEP server do not match the pinned ones
+	issuerCAFingerprintMismatchReason = "CAFingerprintMismatch"
+	// issuerCACertificateNotValidReason is the Ready condition reason if a
+	// CA certificate of the SCEP server is expired or not valid yet
+	issuerCACertificateNotValidReason = "CACertificateNotValid"
+	// issuerUnreachableReason is the Ready condition reason if the SCEP
+	// server does not answer
+	issuerUnreachableReason = "Unreachable"
+	// eventReasonReady and eventReasonNotReady are the reasons of the Events
+	// recorded when the Ready condition of an issuer changes
+	eventReasonReady           = "Ready"
+	eventReasonNotReady        = "NotReady"
 	defaultHealthCheckInterval = time.Minute
+
+	// secretNamesField indexes issuers by the names of their auth Secret and
+	// TLS client certificate Secret
+	secretNamesField = "spec.secretNames"
 )
 
 var (
 	errGetAuthSecret        = errors.New("failed to get Secret containing Issuer credentials")
+	errGetClientCertificate = errors.New("failed to get Secret containing the TLS client certificate")
 	errHealthCheckerBuilder = errors.New("failed to build the healthchecker")
 	errHealthCheckerCheck   = errors.New("healthcheck failed")
 )
 
-// SCEPIssuerReconciler reconciles a Issuer object
+// SCEPIssuerReconciler reconciles a SCEPIssuer or, depending on Kind, a
+// SCEPClusterIssuer object
 type SCEPIssuerReconciler struct {
 	client.Client
 	Kind                     string
 	Scheme                   *runtime.Scheme
 	ClusterResourceNamespace string
-	HealthCheckerBuilder     signer.HealthCheckerBuilder
+	// HealthCheckerBuilder is used to check the SCEP server on every
+	// reconcile. The server is not checked if nil.
+	HealthCheckerBuilder signer.HealthCheckerBuilder
+	// Recorder records Events when the issuer becomes Ready or NotReady.
+	Recorder record.EventRecorder
 }
 
 // Annotation for generating RBAC role for writing Events
 // +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
-//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=issuers,verbs=get;list;watch
-//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=issuers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=scepissuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=scepissuers/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=scepclusterissuers,verbs=get;list;watch
+//+kubebuilder:rbac:groups=cert-manager.heers.it,resources=scepclusterissuers/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
 
 func (r *SCEPIssuerReconciler) newIssuer() (client.Object, error) {
@@ -83,6 +120,8 @@ func (r *SCEPIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 			return ctrl.Result{}, fmt.Errorf("unexpected get error: %v", err)
 		}
 		log.Info("Not found. Ignoring.")
+		metrics.DeleteCertificateExpiry(r.Kind, metrics.IssuerLabel(req.Namespace, req.Name), metrics.CertificateCA)
+		metrics.DeleteCertificateExpiry(r.Kind, metrics.IssuerLabel(req.Namespace, req.Name), metrics.CertificateRA)
 		return ctrl.Result{}, nil
 	}
 
@@ -92,11 +131,18 @@ func (r *SCEPIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
+	var previousReadyStatus scepissuer.ConditionStatus
+	if ready := issuerutil.GetReadyCondition(issuerStatus); ready != nil {
+		previousReadyStatus = ready.Status
+	}
+
 	// Always attempt to update the Ready condition
 	defer func() {
 		if err != nil {
 			issuerutil.SetReadyCondition(issuerStatus, scepissuer.ConditionFalse, issuerReadyConditionReason, err.Error())
 		}
+		r.recordReadyTransition(issuer, previousReadyStatus, issuerutil.GetReadyCondition(issuerStatus))
+		issuerStatus.ObservedGeneration = issuer.GetGeneration()
 		if updateErr := r.Status().Update(ctx, issuer); updateErr != nil {
 			err = utilerrors.NewAggregate([]error{err, updateErr})
 			result = ctrl.Result{}
@@ -105,7 +151,8 @@ func (r *SCEPIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 
 	if ready := issuerutil.GetReadyCondition(issuerStatus); ready == nil {
 		issuerutil.SetReadyCondition(issuerStatus, scepissuer.ConditionUnknown, issuerReadyConditionReason, "First seen")
-		return ctrl.Result{}, nil
+		// status updates do not trigger a reconcile
+		return ctrl.Result{Requeue: true}, nil
 	}
 
 	secretName := types.NamespacedName{
@@ -122,30 +169,225 @@ func (r *SCEPIssuerReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, nil
 	}
 
-	var secret corev1.Secret
-	if err := r.Get(ctx, secretName, &secret); err != nil {
-		return ctrl.Result{}, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, secretName, err)
+	secretData, err := issuerSecretData(ctx, r.Client, issuerSpec, secretName)
+	if err != nil {
+		return ctrl.Result{}, err
 	}
 
-	// checker, err := r.HealthCheckerBuilder(issuerSpec, secret.Data)
-	// if err != nil {
-	// 	return ctrl.Result{}, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err)
-	// }
-
-	// if err := checker.Check(); err != nil {
-	// 	return ctrl.Result{}, fmt.Errorf("%w: %v", errHealthCheckerCheck, err)
-	// }
+	if r.HealthCheckerBuilder != nil {
+		checker, err := r.HealthCheckerBuilder(log, issuerSpec, secretData)
+		if err != nil {
+			return ctrl.Result{}, fmt.Errorf("%w: %v", errHealthCheckerBuilder, err)
+		}
+		// problems of the SCEP server are reported in the Ready condition
+		// and checked again with the next health check
+		info, err := checker.Check(ctx)
+		if err != nil {
+			reason := healthCheckReason(err)
+			err = fmt.Errorf("%w: %v", errHealthCheckerCheck, err)
+			log.Info("Health check failed.", "reason", reason, "error", err.Error())
+			issuerutil.SetReadyCondition(issuerStatus, scepissuer.ConditionFalse, reason, err.Error())
+			return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
+		}
+		if info != nil {
+			setServerInfo(issuerStatus, info)
+			r.setCertificateExpiry(metrics.IssuerLabel(req.Namespace, req.Name), info)
+		}
+		now := metav1.Now()
+		issuerStatus.LastCheckTime = &now
+	}
 
 	issuerutil.SetReadyCondition(issuerStatus, scepissuer.ConditionTrue, issuerReadyConditionReason, "Success")
 	return ctrl.Result{RequeueAfter: defaultHealthCheckInterval}, nil
 }
 
+// recordReadyTransition records an Event if the Ready condition of the issuer
+// changed to True or False.
+func (r *SCEPIssuerReconciler) recordReadyTransition(issuer client.Object, previousStatus scepissuer.ConditionStatus, ready *scepissuer.Condition) {
+	if ready == nil || ready.Status == previousStatus {
+		return
+	}
+	switch ready.Status {
+	case scepissuer.ConditionTrue:
+		r.Recorder.Event(issuer, corev1.EventTypeNormal, eventReasonReady, "The SCEP server is ready")
+	case scepissuer.ConditionFalse:
+		r.Recorder.Eventf(issuer, corev1.EventTypeWarning, eventReasonNotReady, "%s: %s", ready.Reason, ready.Message)
+	}
+}
+
+// setCertificateExpiry records the expiry of the CA certificate and the first
+// expiring RA certificate of the SCEP server, so that an alert can fire before
+// enrollments start to fail.
+func (r *SCEPIssuerReconciler) setCertificateExpiry(issuer string, info *signer.ServerInfo) {
+	metrics.SetCertificateExpiry(r.Kind, issuer, metrics.CertificateCA, info.CA.NotAfter)
+	if len(info.RA) == 0 {
+		metrics.DeleteCertificateExpiry(r.Kind, issuer, metrics.CertificateRA)
+		return
+	}
+	raNotAfter := info.RA[0].NotAfter
+	for _, ra := range info.RA[1:] {
+		if ra.NotAfter.Before(raNotAfter) {
+			raNotAfter = ra.NotAfter
+		}
+	}
+	metrics.SetCertificateExpiry(r.Kind, issuer, metrics.CertificateRA, raNotAfter)
+}
+
+// setServerInfo records the CA and RA certificates of the SCEP server in the
+// issuer status.
+func setServerInfo(status *scepissuer.SCEPIssuerStatus, info *signer.ServerInfo) {
+	status.Capabilities = info.Capabilities
+	ca := certificateInfo(info.CA)
+	status.CA = &ca
+	status.RA = nil
+	for _, ra := range info.RA {
+		status.RA = append(status.RA, certificateInfo(ra))
+	}
+}
+
+func certificateInfo(info signer.CertificateInfo) scepissuer.CertificateInfo {
+	return scepissuer.CertificateInfo{
+		Subject:     info.Subject,
+		Fingerprint: info.Fingerprint,
+		NotAfter:    metav1.NewTime(info.NotAfter),
+	}
+}
+
+// healthCheckReason returns the Ready condition reason for an error of a
+// HealthChecker.
+func healthCheckReason(err error) string {
+	switch {
+	case errors.Is(err, signer.ErrUnreachable):
+		return issuerUnreachableReason
+	case errors.Is(err, signer.ErrCACertificateNotValid):
+		return issuerCACertificateNotValidReason
+	case errors.Is(err, signer.ErrCAFingerprintMismatch):
+		return issuerCAFingerprintMismatchReason
+	case errors.Is(err, signer.ErrAlgorithmNotAdvertised):
+		return issuerUnsupportedAlgorithmReason
+	default:
+		return issuerReadyConditionReason
+	}
+}
+
+func (r *SCEPIssuerReconciler) newIssuerList() (client.ObjectList, error) {
+	listGVK := scepissuer.GroupVersion.WithKind(r.Kind + "List")
+	ro, err := r.Scheme.New(listGVK)
+	if err != nil {
+		return nil, err
+	}
+	return ro.(client.ObjectList), nil
+}
+
+// issuerSecretData returns the data of the auth Secret of an issuer. If the
+// issuer presents a TLS client certificate, its certificate and key are added
+// from the client certificate Secret in the same namespace.
+func issuerSecretData(ctx context.Context, c client.Reader, issuerSpec *scepissuer.SCEPIssuerSpec, secretName types.NamespacedName) (map[string][]byte, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, secretName, &secret); err != nil {
+		return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetAuthSecret, secretName, err)
+	}
+	if issuerSpec.TLS == nil || issuerSpec.TLS.ClientCertificateSecretName == "" {
+		return secret.Data, nil
+	}
+
+	clientCertificateName := types.NamespacedName{
+		Name:      issuerSpec.TLS.ClientCertificateSecretName,
+		Namespace: secretName.Namespace,
+	}
+	var clientCertificate corev1.Secret
+	if err := c.Get(ctx, clientCertificateName, &clientCertificate); err != nil {
+		return nil, fmt.Errorf("%w, secret name: %s, reason: %v", errGetClientCertificate, clientCertificateName, err)
+	}
+
+	data := make(map[string][]byte, len(secret.Data)+2)
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	data[signer.ClientCertificateKey] = clientCertificate.Data[corev1.TLSCertKey]
+	data[signer.ClientKeyKey] = clientCertificate.Data[corev1.TLSPrivateKeyKey]
+	return data, nil
+}
+
+// indexSecretNames returns the names of the auth Secret and the TLS client
+// certificate Secret of an issuer for the secretNamesField index.
+func indexSecretNames(o client.Object) []string {
+	issuerSpec, _, err := issuerutil.GetSpecAndStatus(o)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	if issuerSpec.AuthSecretName != "" {
+		names = append(names, issuerSpec.AuthSecretName)
+	}
+	if issuerSpec.TLS != nil && issuerSpec.TLS.ClientCertificateSecretName != "" {
+		names = append(names, issuerSpec.TLS.ClientCertificateSecretName)
+	}
+	return names
+}
+
+// issuersForSecret maps a Secret to the issuers that use it as auth Secret or
+// TLS client certificate Secret, so that a rotated challenge or client
+// certificate, or a Secret created after the issuer, is picked up without
+// waiting for the next health check.
+func (r *SCEPIssuerReconciler) issuersForSecret(secret client.Object) []reconcile.Request {
+	log := ctrl.Log.WithName("issuer-secret-watch").WithValues("kind", r.Kind, "secret", client.ObjectKeyFromObject(secret))
+
+	opts := []client.ListOption{client.MatchingFields{secretNamesField: secret.GetName()}}
+	switch r.Kind {
+	case "SCEPIssuer":
+		opts = append(opts, client.InNamespace(secret.GetNamespace()))
+	case "SCEPClusterIssuer":
+		if secret.GetNamespace() != r.ClusterResourceNamespace {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	issuers, err := r.newIssuerList()
+	if err != nil {
+		log.Error(err, "Unrecognised issuer list type")
+		return nil
+	}
+	if err := r.List(context.Background(), issuers, opts...); err != nil {
+		log.Error(err, "Failed to list issuers")
+		return nil
+	}
+
+	var requests []reconcile.Request
+	if err := meta.EachListItem(issuers, func(o runtime.Object) error {
+		issuer := o.(client.Object)
+		for _, name := range indexSecretNames(issuer) {
+			if name == secret.GetName() {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(issuer)})
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		log.Error(err, "Failed to read issuers")
+		return nil
+	}
+	return requests
+}
+
 func (r *SCEPIssuerReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	issuerType, err := r.newIssuer()
 	if err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), issuerType, secretNamesField, indexSecretNames); err != nil {
+		return err
+	}
+	// status updates, like the LastCheckTime of every health check or the
+	// LastIssuanceTime, are ignored. The health check interval and the
+	// Secret watch trigger the next check.
 	return ctrl.NewControllerManagedBy(mgr).
-		For(issuerType).
+		For(issuerType, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.issuersForSecret),
+		).
 		Complete(r)
 }
@@ -0,0 +1,658 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	logrtesting "github.com/go-logr/logr/testing"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/mheers/scep-external-issuer/issuer/signer"
+	issuerutil "github.com/mheers/scep-external-issuer/issuer/util"
+)
+
+type fakeSCEPServer struct {
+	caps     signer.Capabilities
+	info     *signer.ServerInfo
+	errCheck error
+}
+
+func (o *fakeSCEPServer) Check(context.Context) (*signer.ServerInfo, error) {
+	if o.errCheck != nil {
+		return nil, o.errCheck
+	}
+	var info signer.ServerInfo
+	if o.info != nil {
+		info = *o.info
+	}
+	info.Capabilities = o.caps
+	return &info, nil
+}
+
+func TestSCEPIssuerReconcile(t *testing.T) {
+	type testCase struct {
+		kind                         string
+		name                         types.NamespacedName
+		objects                      []client.Object
+		scepServer                   *fakeSCEPServer
+		clusterResourceNamespace     string
+		expectedResult               ctrl.Result
+		expectedError                error
+		expectedReadyConditionStatus scepissuerapi.ConditionStatus
+		expectedReadyConditionReason string
+		expectedCapabilities         []string
+		expectedCA                   *scepissuerapi.CertificateInfo
+		expectedRA                   []scepissuerapi.CertificateInfo
+		expectedObservedGeneration   int64
+		expectLastCheckTime          bool
+		expectedEvents               []string
+		expectedSecretData           map[string][]byte
+	}
+
+	caNotAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	serverInfo := &signer.ServerInfo{
+		CA: signer.CertificateInfo{Subject: "CN=test CA", Fingerprint: "00ff", NotAfter: caNotAfter},
+		RA: []signer.CertificateInfo{{Subject: "CN=test RA", Fingerprint: "ff00", NotAfter: caNotAfter}},
+	}
+
+	readyUnknown := scepissuerapi.SCEPIssuerStatus{
+		Status: scepissuerapi.Status{
+			Conditions: []scepissuerapi.Condition{
+				{
+					Type:   scepissuerapi.IssuerConditionReady,
+					Status: scepissuerapi.ConditionUnknown,
+				},
+			},
+		},
+	}
+
+	readyTrue := *readyUnknown.DeepCopy()
+	readyTrue.Conditions[0].Status = scepissuerapi.ConditionTrue
+	readyFalse := *readyUnknown.DeepCopy()
+	readyFalse.Conditions[0].Status = scepissuerapi.ConditionFalse
+	readyFalse.Conditions[0].Reason = issuerUnreachableReason
+
+	tests := map[string]testCase{
+		"success-issuer": {
+			kind: "SCEPIssuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:       "issuer1",
+						Namespace:  "ns1",
+						Generation: 2,
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{caps: signer.Capabilities{"POSTPKIOperation", "SHA-256"}, info: serverInfo},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionTrue,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+			expectedCapabilities:         []string{"POSTPKIOperation", "SHA-256"},
+			expectedCA:                   &scepissuerapi.CertificateInfo{Subject: "CN=test CA", Fingerprint: "00ff", NotAfter: metav1.NewTime(caNotAfter)},
+			expectedRA:                   []scepissuerapi.CertificateInfo{{Subject: "CN=test RA", Fingerprint: "ff00", NotAfter: metav1.NewTime(caNotAfter)}},
+			expectedObservedGeneration:   2,
+			expectLastCheckTime:          true,
+			expectedEvents:               []string{"Normal Ready The SCEP server is ready"},
+		},
+		"success-issuer-client-certificate": {
+			kind: "SCEPIssuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+						TLS: &scepissuerapi.TLSConfig{
+							ClientCertificateSecretName: "issuer1-client-certificate",
+						},
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+					Data: map[string][]byte{
+						"challenge": []byte("challenge"),
+					},
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-client-certificate",
+						Namespace: "ns1",
+					},
+					Type: corev1.SecretTypeTLS,
+					Data: map[string][]byte{
+						corev1.TLSCertKey:       []byte("client certificate"),
+						corev1.TLSPrivateKeyKey: []byte("client key"),
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{caps: signer.Capabilities{"SHA-256"}, info: serverInfo},
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionTrue,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+			expectedCapabilities:         []string{"SHA-256"},
+			expectedCA:                   &scepissuerapi.CertificateInfo{Subject: "CN=test CA", Fingerprint: "00ff", NotAfter: metav1.NewTime(caNotAfter)},
+			expectedRA:                   []scepissuerapi.CertificateInfo{{Subject: "CN=test RA", Fingerprint: "ff00", NotAfter: metav1.NewTime(caNotAfter)}},
+			expectLastCheckTime:          true,
+			expectedSecretData: map[string][]byte{
+				"challenge":                 []byte("challenge"),
+				signer.ClientCertificateKey: []byte("client certificate"),
+				signer.ClientKeyKey:         []byte("client key"),
+			},
+		},
+		"issuer-client-certificate-secret-not-found": {
+			kind: "SCEPIssuer",
+			name: types.NamespacedName{Namespace: "ns1", Name: "issuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1",
+						Namespace: "ns1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "issuer1-credentials",
+						TLS: &scepissuerapi.TLSConfig{
+							ClientCertificateSecretName: "issuer1-client-certificate",
+						},
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "issuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{},
+			expectedError:                errGetClientCertificate,
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+		},
+		"success-cluster-issuer": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{caps: signer.Capabilities{"SHA-256"}, info: serverInfo},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionTrue,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+			expectedCapabilities:         []string{"SHA-256"},
+			expectedCA:                   &scepissuerapi.CertificateInfo{Subject: "CN=test CA", Fingerprint: "00ff", NotAfter: metav1.NewTime(caNotAfter)},
+			expectedRA:                   []scepissuerapi.CertificateInfo{{Subject: "CN=test RA", Fingerprint: "ff00", NotAfter: metav1.NewTime(caNotAfter)}},
+			expectLastCheckTime:          true,
+		},
+		"cluster-issuer-first-seen": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{Requeue: true},
+			expectedReadyConditionStatus: scepissuerapi.ConditionUnknown,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+			expectedEvents:               []string{},
+		},
+		"cluster-issuer-auth-secret-not-in-cluster-resource-namespace": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "ns1",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{},
+			clusterResourceNamespace:     "kube-system",
+			expectedError:                errGetAuthSecret,
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+		},
+		"cluster-issuer-ca-fingerprint-mismatch": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: fmt.Errorf("certificate %q %w", "CN=test", signer.ErrCAFingerprintMismatch)},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerCAFingerprintMismatchReason,
+		},
+		"cluster-issuer-unreachable": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: pkgerrors.WithMessage(signer.ErrUnreachable, "GetCACaps: connection refused")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerUnreachableReason,
+			expectedEvents:               []string{"Warning NotReady Unreachable: healthcheck failed: GetCACaps: connection refused: the SCEP server is unreachable"},
+		},
+		"cluster-issuer-stays-ready": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyTrue.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{caps: signer.Capabilities{"POSTPKIOperation"}, info: serverInfo},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionTrue,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+			expectedCapabilities:         []string{"POSTPKIOperation"},
+			expectedCA:                   &scepissuerapi.CertificateInfo{Subject: "CN=test CA", Fingerprint: "00ff", NotAfter: metav1.NewTime(caNotAfter)},
+			expectedRA:                   []scepissuerapi.CertificateInfo{{Subject: "CN=test RA", Fingerprint: "ff00", NotAfter: metav1.NewTime(caNotAfter)}},
+			expectLastCheckTime:          true,
+			expectedEvents:               []string{},
+		},
+		"cluster-issuer-ready-to-unreachable": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyTrue.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: pkgerrors.WithMessage(signer.ErrUnreachable, "GetCACaps: connection refused")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerUnreachableReason,
+			expectedEvents:               []string{"Warning NotReady Unreachable: healthcheck failed"},
+		},
+		"cluster-issuer-still-unreachable": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyFalse.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: pkgerrors.WithMessage(signer.ErrUnreachable, "GetCACaps: connection refused")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerUnreachableReason,
+			expectedEvents:               []string{},
+		},
+		"cluster-issuer-ca-certificate-not-valid": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: pkgerrors.WithMessage(signer.ErrCACertificateNotValid, "CN=test is valid from 2020-01-01T00:00:00Z to 2021-01-01T00:00:00Z")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerCACertificateNotValidReason,
+		},
+		"cluster-issuer-unsupported-algorithm": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: pkgerrors.WithMessage(signer.ErrAlgorithmNotAdvertised, "digest algorithm SHA-512")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerUnsupportedAlgorithmReason,
+		},
+		"cluster-issuer-health-check-error": {
+			kind: "SCEPClusterIssuer",
+			name: types.NamespacedName{Name: "clusterissuer1"},
+			objects: []client.Object{
+				&scepissuerapi.SCEPClusterIssuer{
+					ObjectMeta: metav1.ObjectMeta{
+						Name: "clusterissuer1",
+					},
+					Spec: scepissuerapi.SCEPIssuerSpec{
+						AuthSecretName: "clusterissuer1-credentials",
+					},
+					Status: *readyUnknown.DeepCopy(),
+				},
+				&corev1.Secret{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      "clusterissuer1-credentials",
+						Namespace: "kube-system",
+					},
+				},
+			},
+			scepServer:                   &fakeSCEPServer{errCheck: errors.New("simulated health check error")},
+			clusterResourceNamespace:     "kube-system",
+			expectedResult:               ctrl.Result{RequeueAfter: defaultHealthCheckInterval},
+			expectedReadyConditionStatus: scepissuerapi.ConditionFalse,
+			expectedReadyConditionReason: issuerReadyConditionReason,
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, scepissuerapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(tc.objects...).
+				Build()
+			var secretData map[string][]byte
+			controller := SCEPIssuerReconciler{
+				Kind:                     tc.kind,
+				Client:                   fakeClient,
+				Scheme:                   scheme,
+				ClusterResourceNamespace: tc.clusterResourceNamespace,
+				HealthCheckerBuilder: func(_ logr.Logger, _ *scepissuerapi.SCEPIssuerSpec, data map[string][]byte) (signer.HealthChecker, error) {
+					secretData = data
+					return tc.scepServer, nil
+				},
+				Recorder: record.NewFakeRecorder(10),
+			}
+			result, err := controller.Reconcile(
+				ctrl.LoggerInto(context.TODO(), logrtesting.NewTestLogger(t)),
+				reconcile.Request{NamespacedName: tc.name},
+			)
+			if tc.expectedError != nil {
+				assertErrorIs(t, tc.expectedError, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedResult, result, "Unexpected result")
+
+			issuer, err := controller.newIssuer()
+			require.NoError(t, err)
+			require.NoError(t, fakeClient.Get(context.TODO(), tc.name, issuer))
+			_, issuerStatus, err := issuerutil.GetSpecAndStatus(issuer)
+			require.NoError(t, err)
+			ready := issuerutil.GetReadyCondition(issuerStatus)
+			if assert.NotNil(t, ready, "Ready condition not found") {
+				assert.Equal(t, tc.expectedReadyConditionStatus, ready.Status)
+				assert.Equal(t, tc.expectedReadyConditionReason, ready.Reason)
+			}
+			assert.Equal(t, tc.expectedCapabilities, issuerStatus.Capabilities)
+			if tc.expectedCA != nil {
+				// the time zone is not preserved by the fake client
+				if assert.NotNil(t, issuerStatus.CA) {
+					assert.Equal(t, tc.expectedCA.Subject, issuerStatus.CA.Subject)
+					assert.Equal(t, tc.expectedCA.Fingerprint, issuerStatus.CA.Fingerprint)
+					assert.True(t, tc.expectedCA.NotAfter.Equal(&issuerStatus.CA.NotAfter))
+				}
+			} else {
+				assert.Nil(t, issuerStatus.CA)
+			}
+			if assert.Len(t, issuerStatus.RA, len(tc.expectedRA)) {
+				for i, ra := range tc.expectedRA {
+					assert.Equal(t, ra.Subject, issuerStatus.RA[i].Subject)
+					assert.Equal(t, ra.Fingerprint, issuerStatus.RA[i].Fingerprint)
+				}
+			}
+			assert.Equal(t, tc.expectedObservedGeneration, issuerStatus.ObservedGeneration)
+			assert.Equal(t, tc.expectLastCheckTime, issuerStatus.LastCheckTime != nil, "unexpected lastCheckTime %v", issuerStatus.LastCheckTime)
+			if tc.expectedEvents != nil {
+				assertEvents(t, controller.Recorder.(*record.FakeRecorder), tc.expectedEvents)
+			}
+			if tc.expectedSecretData != nil {
+				assert.Equal(t, tc.expectedSecretData, secretData)
+			}
+		})
+	}
+}
+
+func TestIssuersForSecret(t *testing.T) {
+	issuer := func(namespace, name, secretName string) *scepissuerapi.SCEPIssuer {
+		return &scepissuerapi.SCEPIssuer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       scepissuerapi.SCEPIssuerSpec{AuthSecretName: secretName},
+		}
+	}
+	clusterIssuer := func(name, secretName string) *scepissuerapi.SCEPClusterIssuer {
+		return &scepissuerapi.SCEPClusterIssuer{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       scepissuerapi.SCEPIssuerSpec{AuthSecretName: secretName},
+		}
+	}
+	withClientCertificate := func(issuer *scepissuerapi.SCEPIssuer, secretName string) *scepissuerapi.SCEPIssuer {
+		issuer.Spec.TLS = &scepissuerapi.TLSConfig{ClientCertificateSecretName: secretName}
+		return issuer
+	}
+	objects := []client.Object{
+		withClientCertificate(issuer("ns1", "issuer1", "credentials"), "client-certificate"),
+		issuer("ns1", "issuer2", "credentials"),
+		issuer("ns1", "issuer3", "other-credentials"),
+		issuer("ns2", "issuer1", "credentials"),
+		clusterIssuer("clusterissuer1", "credentials"),
+		clusterIssuer("clusterissuer2", "other-credentials"),
+	}
+
+	tests := map[string]struct {
+		kind             string
+		secret           types.NamespacedName
+		expectedRequests []reconcile.Request
+	}{
+		"issuers-in-secret-namespace": {
+			kind:   "SCEPIssuer",
+			secret: types.NamespacedName{Namespace: "ns1", Name: "credentials"},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "issuer1"}},
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "issuer2"}},
+			},
+		},
+		"issuers-client-certificate-secret": {
+			kind:   "SCEPIssuer",
+			secret: types.NamespacedName{Namespace: "ns1", Name: "client-certificate"},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "ns1", Name: "issuer1"}},
+			},
+		},
+		"issuers-unreferenced-secret": {
+			kind:   "SCEPIssuer",
+			secret: types.NamespacedName{Namespace: "ns1", Name: "unrelated"},
+		},
+		"cluster-issuers-in-cluster-resource-namespace": {
+			kind:   "SCEPClusterIssuer",
+			secret: types.NamespacedName{Namespace: "kube-system", Name: "credentials"},
+			expectedRequests: []reconcile.Request{
+				{NamespacedName: types.NamespacedName{Name: "clusterissuer1"}},
+			},
+		},
+		"cluster-issuers-secret-in-other-namespace": {
+			kind:   "SCEPClusterIssuer",
+			secret: types.NamespacedName{Namespace: "ns1", Name: "credentials"},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	require.NoError(t, scepissuerapi.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			fakeClient := fake.NewClientBuilder().
+				WithScheme(scheme).
+				WithObjects(objects...).
+				Build()
+			controller := SCEPIssuerReconciler{
+				Kind:                     tc.kind,
+				Client:                   fakeClient,
+				Scheme:                   scheme,
+				ClusterResourceNamespace: "kube-system",
+			}
+			requests := controller.issuersForSecret(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: tc.secret.Namespace, Name: tc.secret.Name},
+			})
+			assert.ElementsMatch(t, tc.expectedRequests, requests)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022 Marcel Heers.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics holds the Prometheus metrics of the issuer. They are
+// registered with the controller-runtime registry and served on the metrics
+// endpoint of the manager.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/types"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "scep_issuer"
+
+// Outcomes of an enrollment.
+const (
+	OutcomeIssued  = "issued"
+	OutcomePending = "pending"
+	OutcomeFailed  = "failed"
+	OutcomeError   = "error"
+)
+
+// Outcomes of a SCEP operation.
+const (
+	OperationSuccess = "success"
+	OperationError   = "error"
+)
+
+// Certificates of a SCEP server whose expiry is recorded.
+const (
+	CertificateCA = "ca"
+	CertificateRA = "ra"
+)
+
+var (
+	enrollmentsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "enrollments_total",
+		Help:      "Number of enrollment requests sent to the SCEP server by issuer, outcome and failInfo.",
+	}, []string{"kind", "issuer", "outcome", "fail_info"})
+
+	enrollmentDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "enrollment_duration_seconds",
+		Help:      "Duration of enrollment requests including GetCACaps and GetCACert by issuer and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind", "issuer", "outcome"})
+
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the HTTP requests to the SCEP server by operation and outcome.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation", "outcome"})
+
+	pendingTransactions = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_transactions",
+		Help:      "Number of CertificateRequests the SCEP server answered with PENDING by issuer.",
+	}, []string{"kind", "issuer"})
+
+	certificateExpiration = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiration_timestamp_seconds",
+		Help:      "Expiry of the CA certificate and the first expiring RA certificate of the SCEP server by issuer.",
+	}, []string{"kind", "issuer", "certificate"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		enrollmentsTotal,
+		enrollmentDuration,
+		operationDuration,
+		pendingTransactions,
+		certificateExpiration,
+	)
+}
+
+// IssuerLabel returns the issuer label of an issuer. ClusterIssuers have no
+// namespace.
+func IssuerLabel(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// FailInfoLabel returns the fail_info label of a SCEP failInfo.
+func FailInfoLabel(failInfo scep.FailInfo) string {
+	switch failInfo {
+	case scep.BadAlg:
+		return "badAlg"
+	case scep.BadMessageCheck:
+		return "badMessageCheck"
+	case scep.BadRequest:
+		return "badRequest"
+	case scep.BadTime:
+		return "badTime"
+	case scep.BadCertID:
+		return "badCertID"
+	default:
+		return "unknown"
+	}
+}
+
+// ObserveEnrollment records an enrollment request and its duration.
+// failInfo is only set for the failed outcome.
+func ObserveEnrollment(kind, issuer, outcome, failInfo string, duration time.Duration) {
+	enrollmentsTotal.WithLabelValues(kind, issuer, outcome, failInfo).Inc()
+	enrollmentDuration.WithLabelValues(kind, issuer, outcome).Observe(duration.Seconds())
+}
+
+// ObserveOperation records the duration of a SCEP operation.
+func ObserveOperation(operation string, err error, duration time.Duration) {
+	outcome := OperationSuccess
+	if err != nil {
+		outcome = OperationError
+	}
+	operationDuration.WithLabelValues(operation, outcome).Observe(duration.Seconds())
+}
+
+// SetCertificateExpiry records the expiry of a certificate of the SCEP server
+// of an issuer.
+func SetCertificateExpiry(kind, issuer, certificate string, notAfter time.Time) {
+	certificateExpiration.WithLabelValues(kind, issuer, certificate).Set(float64(notAfter.Unix()))
+}
+
+// DeleteCertificateExpiry removes the expiry of a certificate of the SCEP
+// server of an issuer, e.g. because the server has no RA or the issuer was
+// deleted.
+func DeleteCertificateExpiry(kind, issuer, certificate string) {
+	certificateExpiration.DeleteLabelValues(kind, issuer, certificate)
+}
+
+type pendingIssuer struct {
+	kind, issuer string
+}
+
+// pending holds the issuer of every pending CertificateRequest, so that a
+// request is only counted once however often it is reconciled.
+var pending = struct {
+	sync.Mutex
+	requests map[types.NamespacedName]pendingIssuer
+}{requests: map[types.NamespacedName]pendingIssuer{}}
+
+// SetPending records whether the SCEP transaction of a CertificateRequest is
+// pending at the SCEP server of an issuer.
+func SetPending(certificateRequest types.NamespacedName, kind, issuer string, isPending bool) {
+	pending.Lock()
+	defer pending.Unlock()
+
+	current, tracked := pending.requests[certificateRequest]
+	next := pendingIssuer{kind: kind, issuer: issuer}
+	if tracked && (!isPending || current != next) {
+		pendingTransactions.WithLabelValues(current.kind, current.issuer).Dec()
+		delete(pending.requests, certificateRequest)
+		tracked = false
+	}
+	if isPending && !tracked {
+		pendingTransactions.WithLabelValues(kind, issuer).Inc()
+		pending.requests[certificateRequest] = next
+	}
+}
+
+// ForgetPending removes a deleted CertificateRequest from the pending
+// transactions.
+func ForgetPending(certificateRequest types.NamespacedName) {
+	SetPending(certificateRequest, "", "", false)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 Marcel Heers.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIssuerLabel(t *testing.T) {
+	assert.Equal(t, "ns1/issuer1", IssuerLabel("ns1", "issuer1"))
+	assert.Equal(t, "clusterissuer1", IssuerLabel("", "clusterissuer1"))
+}
+
+func TestFailInfoLabel(t *testing.T) {
+	tests := map[scep.FailInfo]string{
+		scep.BadAlg:          "badAlg",
+		scep.BadMessageCheck: "badMessageCheck",
+		scep.BadRequest:      "badRequest",
+		scep.BadTime:         "badTime",
+		scep.BadCertID:       "badCertID",
+		"":                   "unknown",
+		"42":                 "unknown",
+	}
+	for failInfo, expected := range tests {
+		assert.Equal(t, expected, FailInfoLabel(failInfo), "failInfo %q", string(failInfo))
+	}
+}
+
+func TestObserveEnrollment(t *testing.T) {
+	ObserveEnrollment("SCEPIssuer", "ns1/enrollment", OutcomeFailed, "badRequest", time.Second)
+	ObserveEnrollment("SCEPIssuer", "ns1/enrollment", OutcomeFailed, "badRequest", time.Second)
+	ObserveEnrollment("SCEPIssuer", "ns1/enrollment", OutcomeIssued, "", time.Second)
+
+	assert.Equal(t, 2.0, testutil.ToFloat64(enrollmentsTotal.WithLabelValues("SCEPIssuer", "ns1/enrollment", OutcomeFailed, "badRequest")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(enrollmentsTotal.WithLabelValues("SCEPIssuer", "ns1/enrollment", OutcomeIssued, "")))
+}
+
+func TestObserveOperation(t *testing.T) {
+	before := testutil.CollectAndCount(operationDuration)
+	ObserveOperation("GetCACert", nil, time.Second)
+	ObserveOperation("GetCACert", errors.New("connection refused"), time.Second)
+	assert.Equal(t, before+2, testutil.CollectAndCount(operationDuration))
+}
+
+func TestSetPending(t *testing.T) {
+	cr1 := types.NamespacedName{Namespace: "ns1", Name: "cr1"}
+	cr2 := types.NamespacedName{Namespace: "ns1", Name: "cr2"}
+	gauge := func(issuer string) float64 {
+		return testutil.ToFloat64(pendingTransactions.WithLabelValues("SCEPIssuer", issuer))
+	}
+
+	SetPending(cr1, "SCEPIssuer", "ns1/pending", true)
+	SetPending(cr1, "SCEPIssuer", "ns1/pending", true)
+	SetPending(cr2, "SCEPIssuer", "ns1/pending", true)
+	assert.Equal(t, 2.0, gauge("ns1/pending"), "a request is counted once")
+
+	SetPending(cr2, "SCEPIssuer", "ns1/other", true)
+	assert.Equal(t, 1.0, gauge("ns1/pending"), "a request moves to its new issuer")
+	assert.Equal(t, 1.0, gauge("ns1/other"))
+
+	SetPending(cr1, "SCEPIssuer", "ns1/pending", false)
+	ForgetPending(cr2)
+	ForgetPending(cr2)
+	assert.Equal(t, 0.0, gauge("ns1/pending"))
+	assert.Equal(t, 0.0, gauge("ns1/other"))
+}
+
+func TestCertificateExpiry(t *testing.T) {
+	notAfter := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	SetCertificateExpiry("SCEPClusterIssuer", "expiry", CertificateCA, notAfter)
+	assert.Equal(t, float64(notAfter.Unix()), testutil.ToFloat64(certificateExpiration.WithLabelValues("SCEPClusterIssuer", "expiry", CertificateCA)))
+
+	before := testutil.CollectAndCount(certificateExpiration)
+	DeleteCertificateExpiry("SCEPClusterIssuer", "expiry", CertificateCA)
+	assert.Equal(t, before-1, testutil.CollectAndCount(certificateExpiration))
+}
@@ -0,0 +1,229 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCAFingerprintMismatch is returned if the certificates of a SCEP server
+// do not match the pinned CA fingerprints or CA bundle.
+var ErrCAFingerprintMismatch = errors.New("does not match the pinned CA fingerprints or CA bundle")
+
+// ErrCACertificateNotValid is returned if a certificate of a SCEP server is
+// expired or not valid yet.
+var ErrCACertificateNotValid = errors.New("CA certificate is not valid")
+
+// caCertificates are the certificates of a GetCACert response sorted by their
+// role, see RFC 8894 section 3.5.1. Servers with an RA, like NDES, return
+// separate RA certificates for encryption and signing besides the CA chain.
+type caCertificates struct {
+	// CA is the certificate of the CA which issues the certificates.
+	CA *x509.Certificate
+	// Recipient is the certificate messages are encrypted to. It is the RA
+	// encryption certificate or the CA if there is no RA.
+	Recipient *x509.Certificate
+	// Signer is the certificate responses are signed with. It is the RA
+	// signing certificate or the CA if there is no RA.
+	Signer *x509.Certificate
+	// All holds all certificates of the response.
+	All []*x509.Certificate
+}
+
+// classifyCACertificates sorts the certificates of a GetCACert response by
+// their basic constraints and key usage.
+func classifyCACertificates(certs []*x509.Certificate) (*caCertificates, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("GetCACert returned no certificates")
+	}
+
+	var cas, ras []*x509.Certificate
+	for _, cert := range certs {
+		if isCA(cert) {
+			cas = append(cas, cert)
+		} else {
+			ras = append(ras, cert)
+		}
+	}
+
+	ca := issuingCA(cas, ras)
+	if ca == nil {
+		ca = certs[0]
+	}
+	caCerts := &caCertificates{
+		CA:        ca,
+		Recipient: ca,
+		Signer:    ca,
+		All:       certs,
+	}
+	if recipient := certWithKeyUsage(ras, x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment); recipient != nil {
+		caCerts.Recipient = recipient
+	}
+	if signer := certWithKeyUsage(ras, x509.KeyUsageDigitalSignature); signer != nil {
+		caCerts.Signer = signer
+	}
+	return caCerts, nil
+}
+
+// verify checks that the CA, RA encryption and RA signing certificates match
+// one of the fingerprints, are in the bundle or chain to such a certificate.
+// Nothing is verified if neither fingerprints nor bundle are set.
+func (c *caCertificates) verify(fingerprints []string, bundle []byte) error {
+	if len(fingerprints) == 0 && len(bundle) == 0 {
+		return nil
+	}
+
+	roots := x509.NewCertPool()
+	if len(bundle) > 0 && !roots.AppendCertsFromPEM(bundle) {
+		return errors.New("CA bundle contains no PEM encoded certificates")
+	}
+	for _, fingerprint := range fingerprints {
+		pinned, err := hex.DecodeString(strings.ReplaceAll(fingerprint, ":", ""))
+		if err != nil || len(pinned) != sha256.Size {
+			return errors.Errorf("invalid SHA-256 CA fingerprint %q", fingerprint)
+		}
+		for _, cert := range c.All {
+			if fp := sha256.Sum256(cert.Raw); bytes.Equal(fp[:], pinned) {
+				roots.AddCert(cert)
+			}
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range c.All {
+		intermediates.AddCert(cert)
+	}
+	for _, cert := range []*x509.Certificate{c.CA, c.Recipient, c.Signer} {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("certificate %q %w: %v", cert.Subject, ErrCAFingerprintMismatch, err)
+		}
+	}
+	return nil
+}
+
+// checkValidity checks that all certificates are valid at now.
+func (c *caCertificates) checkValidity(now time.Time) error {
+	for _, cert := range c.All {
+		if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return errors.WithMessagef(ErrCACertificateNotValid, "%q is valid from %s to %s", cert.Subject,
+				cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// info describes the CA certificate and the RA certificates if there is an
+// RA.
+func (c *caCertificates) info() *ServerInfo {
+	info := &ServerInfo{CA: certificateInfo(c.CA)}
+	if c.Recipient != c.CA {
+		info.RA = append(info.RA, certificateInfo(c.Recipient))
+	}
+	if c.Signer != c.CA && c.Signer != c.Recipient {
+		info.RA = append(info.RA, certificateInfo(c.Signer))
+	}
+	return info
+}
+
+func certificateInfo(cert *x509.Certificate) CertificateInfo {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return CertificateInfo{
+		Subject:     cert.Subject.String(),
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		NotAfter:    cert.NotAfter,
+	}
+}
+
+// issuingCA returns the CA which issues the certificates. This is the issuer
+// of the RA certificates or, without RA, the CA that did not issue any of the
+// other CA certificates.
+func issuingCA(cas, ras []*x509.Certificate) *x509.Certificate {
+	for _, ra := range ras {
+		if issuer := caIssuer(ra, cas); issuer != nil {
+			return issuer
+		}
+	}
+	for _, ca := range cas {
+		if !issuesCA(ca, cas) {
+			return ca
+		}
+	}
+	if len(cas) > 0 {
+		return cas[0]
+	}
+	return nil
+}
+
+// certWithKeyUsage returns the first certificate which allows one of usages.
+// Certificates without key usage allow all usages and are only returned if
+// there is no certificate with a matching key usage.
+func certWithKeyUsage(certs []*x509.Certificate, usages x509.KeyUsage) *x509.Certificate {
+	for _, cert := range certs {
+		if cert.KeyUsage&usages != 0 {
+			return cert
+		}
+	}
+	for _, cert := range certs {
+		if cert.KeyUsage == 0 {
+			return cert
+		}
+	}
+	return nil
+}
+
+// caChain returns the chain of CA certificates from certs which issued cert,
+// starting with the issuer of cert. Other certificates of a GetCACert
+// response, e.g. of an RA, are not part of the chain.
+func caChain(cert *x509.Certificate, certs []*x509.Certificate) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for len(chain) < len(certs) {
+		issuer := caIssuer(cert, certs)
+		if issuer == nil {
+			break
+		}
+		chain = append(chain, issuer)
+		if issuer.CheckSignatureFrom(issuer) == nil {
+			// self-signed root CA
+			break
+		}
+		cert = issuer
+	}
+	return chain
+}
+
+func caIssuer(cert *x509.Certificate, certs []*x509.Certificate) *x509.Certificate {
+	for _, ca := range certs {
+		if !isCA(ca) || ca.Equal(cert) {
+			continue
+		}
+		if cert.CheckSignatureFrom(ca) == nil {
+			return ca
+		}
+	}
+	return nil
+}
+
+// issuesCA reports whether ca issued one of the other certificates in cas.
+func issuesCA(ca *x509.Certificate, cas []*x509.Certificate) bool {
+	for _, cert := range cas {
+		if !cert.Equal(ca) && cert.CheckSignatureFrom(ca) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func isCA(cert *x509.Certificate) bool {
+	return cert.BasicConstraintsValid && cert.IsCA
+}
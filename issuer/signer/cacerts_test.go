@@ -0,0 +1,126 @@
+package signer
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyCACertificates(t *testing.T) {
+	root, rootKey := newTestCertificate(t, "root", true, x509.KeyUsageCertSign, nil, nil)
+	intermediate, intermediateKey := newTestCertificate(t, "intermediate", true, x509.KeyUsageCertSign, root, rootKey)
+	raSign, _ := newTestCertificate(t, "ra signing", false, x509.KeyUsageDigitalSignature, intermediate, intermediateKey)
+	raEncrypt, _ := newTestCertificate(t, "ra encryption", false, x509.KeyUsageKeyEncipherment, intermediate, intermediateKey)
+	ra, _ := newTestCertificate(t, "ra", false, 0, intermediate, intermediateKey)
+
+	tests := map[string]struct {
+		certs     []*x509.Certificate
+		ca        *x509.Certificate
+		recipient *x509.Certificate
+		signer    *x509.Certificate
+	}{
+		"ca": {
+			certs:     []*x509.Certificate{root},
+			ca:        root,
+			recipient: root,
+			signer:    root,
+		},
+		"ca-chain": {
+			certs:     []*x509.Certificate{root, intermediate},
+			ca:        intermediate,
+			recipient: intermediate,
+			signer:    intermediate,
+		},
+		"separate-ra-certificates": {
+			certs:     []*x509.Certificate{raSign, raEncrypt, root, intermediate},
+			ca:        intermediate,
+			recipient: raEncrypt,
+			signer:    raSign,
+		},
+		"ra-without-key-usage": {
+			certs:     []*x509.Certificate{intermediate, ra},
+			ca:        intermediate,
+			recipient: ra,
+			signer:    ra,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			caCerts, err := classifyCACertificates(tc.certs)
+			require.Nil(t, err)
+			require.Equal(t, tc.ca, caCerts.CA)
+			require.Equal(t, tc.recipient, caCerts.Recipient)
+			require.Equal(t, tc.signer, caCerts.Signer)
+		})
+	}
+
+	_, err := classifyCACertificates(nil)
+	require.Error(t, err)
+}
+
+func TestVerifyCACertificates(t *testing.T) {
+	root, rootKey := newTestCertificate(t, "root", true, x509.KeyUsageCertSign, nil, nil)
+	intermediate, intermediateKey := newTestCertificate(t, "intermediate", true, x509.KeyUsageCertSign, root, rootKey)
+	raSign, _ := newTestCertificate(t, "ra signing", false, x509.KeyUsageDigitalSignature, intermediate, intermediateKey)
+	raEncrypt, _ := newTestCertificate(t, "ra encryption", false, x509.KeyUsageKeyEncipherment, intermediate, intermediateKey)
+	other, _ := newTestCertificate(t, "other", true, x509.KeyUsageCertSign, nil, nil)
+
+	fingerprint := func(cert *x509.Certificate) string {
+		fp := sha256.Sum256(cert.Raw)
+		return hex.EncodeToString(fp[:])
+	}
+	// withColons formats a fingerprint like openssl x509 -fingerprint
+	withColons := func(fingerprint string) string {
+		var parts []string
+		for i := 0; i < len(fingerprint); i += 2 {
+			parts = append(parts, fingerprint[i:i+2])
+		}
+		return strings.ToUpper(strings.Join(parts, ":"))
+	}
+
+	caCerts, err := classifyCACertificates([]*x509.Certificate{raSign, raEncrypt, root, intermediate})
+	require.Nil(t, err)
+
+	tests := map[string]struct {
+		fingerprints []string
+		bundle       []byte
+		expectedErr  error
+	}{
+		"nothing-pinned": {},
+		"root-fingerprint": {
+			fingerprints: []string{fingerprint(other), fingerprint(root)},
+		},
+		"intermediate-fingerprint-with-colons": {
+			fingerprints: []string{withColons(fingerprint(intermediate))},
+		},
+		"other-fingerprint": {
+			fingerprints: []string{fingerprint(other)},
+			expectedErr:  ErrCAFingerprintMismatch,
+		},
+		"root-bundle": {
+			bundle: pemCert(root.Raw),
+		},
+		"other-bundle": {
+			bundle:      pemCert(other.Raw),
+			expectedErr: ErrCAFingerprintMismatch,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := caCerts.verify(tc.fingerprints, tc.bundle)
+			if tc.expectedErr != nil {
+				require.ErrorIs(t, err, tc.expectedErr)
+			} else {
+				require.Nil(t, err)
+			}
+		})
+	}
+
+	err = caCerts.verify([]string{"not a fingerprint"}, nil)
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrCAFingerprintMismatch)
+}
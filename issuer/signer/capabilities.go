@@ -0,0 +1,130 @@
+package signer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/asn1"
+	"strings"
+
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+)
+
+// ErrAlgorithmNotAdvertised is returned if an algorithm configured on the
+// issuer is not advertised by the SCEP server.
+var ErrAlgorithmNotAdvertised = errors.New("not advertised by the SCEP server")
+
+// Capabilities advertised by a SCEP server in its GetCACaps response, see
+// RFC 8894 section 3.5.2
+const (
+	CapAES              = "AES"
+	CapDES3             = "DES3"
+	CapGetNextCACert    = "GetNextCACert"
+	CapPOSTPKIOperation = "POSTPKIOperation"
+	CapRenewal          = "Renewal"
+	CapSHA1             = "SHA-1"
+	CapSHA256           = "SHA-256"
+	CapSHA512           = "SHA-512"
+	CapSCEPStandard     = "SCEPStandard"
+)
+
+// Capabilities is the list of capabilities a SCEP server advertises.
+type Capabilities []string
+
+// ParseCapabilities parses a GetCACaps response. Every capability is on its
+// own line.
+func ParseCapabilities(data []byte) Capabilities {
+	var caps Capabilities
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if c := strings.TrimSpace(scanner.Text()); c != "" {
+			caps = append(caps, c)
+		}
+	}
+	return caps
+}
+
+// Supports reports whether the server advertises capability c. Capability
+// names are case-insensitive. SCEPStandard implies AES, POSTPKIOperation and
+// SHA-256.
+func (caps Capabilities) Supports(c string) bool {
+	for _, capability := range caps {
+		if strings.EqualFold(capability, c) {
+			return true
+		}
+	}
+	switch c {
+	case CapAES, CapPOSTPKIOperation, CapSHA256:
+		return caps.Supports(CapSCEPStandard)
+	}
+	return false
+}
+
+// contentEncryption returns the strongest envelope cipher the server
+// advertises. Servers that advertise none only have to support single DES.
+func (caps Capabilities) contentEncryption() contentEncryptionAlgorithm {
+	switch {
+	case caps.Supports(CapAES):
+		return encryptionAES128CBC
+	case caps.Supports(CapDES3):
+		return encryptionDES3CBC
+	default:
+		return encryptionDESCBC
+	}
+}
+
+// digest returns the OID of the strongest message digest the server
+// advertises. SHA-1 is the fallback for servers that advertise none.
+func (caps Capabilities) digest() asn1.ObjectIdentifier {
+	switch {
+	case caps.Supports(CapSHA512):
+		return pkcs7.OIDDigestAlgorithmSHA512
+	case caps.Supports(CapSHA256):
+		return pkcs7.OIDDigestAlgorithmSHA256
+	default:
+		return pkcs7.OIDDigestAlgorithmSHA1
+	}
+}
+
+// algorithms returns the envelope cipher and digest for a message. Algorithms
+// configured on the issuer take precedence over the negotiated ones, but
+// they have to be advertised by the server.
+func (caps Capabilities) algorithms(encryption scepissuerapi.ContentEncryptionAlgorithm, digest scepissuerapi.DigestAlgorithm) (contentEncryptionAlgorithm, asn1.ObjectIdentifier, error) {
+	alg := caps.contentEncryption()
+	if encryption != "" {
+		var capability string
+		switch encryption {
+		case scepissuerapi.ContentEncryptionDES3:
+			alg, capability = encryptionDES3CBC, CapDES3
+		case scepissuerapi.ContentEncryptionAES128CBC:
+			alg, capability = encryptionAES128CBC, CapAES
+		case scepissuerapi.ContentEncryptionAES256CBC:
+			alg, capability = encryptionAES256CBC, CapAES
+		default:
+			return contentEncryptionAlgorithm{}, nil, errors.Errorf("unknown content encryption algorithm %s", encryption)
+		}
+		if !caps.Supports(capability) {
+			return contentEncryptionAlgorithm{}, nil, errors.WithMessagef(ErrAlgorithmNotAdvertised, "content encryption algorithm %s", encryption)
+		}
+	}
+
+	digestOID := caps.digest()
+	if digest != "" {
+		var capability string
+		switch digest {
+		case scepissuerapi.DigestSHA1:
+			digestOID, capability = pkcs7.OIDDigestAlgorithmSHA1, CapSHA1
+		case scepissuerapi.DigestSHA256:
+			digestOID, capability = pkcs7.OIDDigestAlgorithmSHA256, CapSHA256
+		case scepissuerapi.DigestSHA512:
+			digestOID, capability = pkcs7.OIDDigestAlgorithmSHA512, CapSHA512
+		default:
+			return contentEncryptionAlgorithm{}, nil, errors.Errorf("unknown digest algorithm %s", digest)
+		}
+		if !caps.Supports(capability) {
+			return contentEncryptionAlgorithm{}, nil, errors.WithMessagef(ErrAlgorithmNotAdvertised, "digest algorithm %s", digest)
+		}
+	}
+	return alg, digestOID, nil
+}
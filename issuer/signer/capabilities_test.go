@@ -0,0 +1,58 @@
+package signer
+
+import (
+	"testing"
+
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	caps := ParseCapabilities([]byte("Renewal\r\nSHA-256\n\nAES\n"))
+	require.Equal(t, Capabilities{"Renewal", "SHA-256", "AES"}, caps)
+
+	require.True(t, caps.Supports(CapRenewal))
+	require.True(t, caps.Supports("sha-256"))
+	require.False(t, caps.Supports(CapPOSTPKIOperation))
+	require.False(t, caps.Supports(CapDES3))
+}
+
+func TestCapabilitiesSCEPStandard(t *testing.T) {
+	caps := Capabilities{CapSCEPStandard}
+	require.True(t, caps.Supports(CapAES))
+	require.True(t, caps.Supports(CapPOSTPKIOperation))
+	require.True(t, caps.Supports(CapSHA256))
+	require.False(t, caps.Supports(CapSHA512))
+	require.False(t, caps.Supports(CapRenewal))
+}
+
+func TestCapabilitiesAlgorithms(t *testing.T) {
+	tests := []struct {
+		caps       Capabilities
+		encryption contentEncryptionAlgorithm
+		digest     string
+	}{
+		{nil, encryptionDESCBC, pkcs7.OIDDigestAlgorithmSHA1.String()},
+		{Capabilities{CapDES3, CapSHA1}, encryptionDES3CBC, pkcs7.OIDDigestAlgorithmSHA1.String()},
+		{Capabilities{CapDES3, CapAES, CapSHA256}, encryptionAES128CBC, pkcs7.OIDDigestAlgorithmSHA256.String()},
+		{Capabilities{CapSCEPStandard, CapSHA512}, encryptionAES128CBC, pkcs7.OIDDigestAlgorithmSHA512.String()},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.encryption.oid, tc.caps.contentEncryption().oid, "caps: %v", tc.caps)
+		require.Equal(t, tc.digest, tc.caps.digest().String(), "caps: %v", tc.caps)
+	}
+}
+
+func TestCapabilitiesConfiguredAlgorithms(t *testing.T) {
+	caps := Capabilities{CapAES, CapSHA256}
+
+	encryption, digest, err := caps.algorithms(scepissuerapi.ContentEncryptionAES256CBC, scepissuerapi.DigestSHA256)
+	require.Nil(t, err)
+	require.Equal(t, encryptionAES256CBC.oid, encryption.oid)
+	require.Equal(t, pkcs7.OIDDigestAlgorithmSHA256, digest)
+
+	_, _, err = caps.algorithms(scepissuerapi.ContentEncryptionDES3, "")
+	require.ErrorIs(t, err, ErrAlgorithmNotAdvertised)
+	require.ErrorContains(t, err, "DES3")
+}
@@ -0,0 +1,122 @@
+package signer
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-logr/logr"
+	"github.com/micromdm/scep/v2/cryptoutil/x509util"
+	"github.com/micromdm/scep/v2/scep"
+)
+
+// Verbosity levels of the signer log lines. Results of a request are logged
+// at the default level.
+const (
+	// LogLevelDebug logs every HTTP request to the SCEP server.
+	LogLevelDebug = 1
+	// LogLevelTrace additionally logs the decoded attributes of every
+	// pkiMessage and the debug lines of the scep package.
+	LogLevelTrace = 2
+)
+
+const redacted = "<redacted>"
+
+// sensitiveKeys are substrings of log keys whose values are never logged.
+var sensitiveKeys = []string{"challenge", "password", "secret"}
+
+// redact returns value, or a placeholder if key names a challenge password or
+// another secret.
+func redact(key string, value interface{}) interface{} {
+	key = strings.ToLower(key)
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return redacted
+		}
+	}
+	return value
+}
+
+// kitLogger passes the log lines of the go-kit based SCEP client and scep
+// package to a logr.Logger. Lines of the debug level of go-kit are logged at
+// LogLevelTrace, all others at LogLevelDebug.
+type kitLogger struct {
+	log logr.Logger
+}
+
+var _ log.Logger = kitLogger{}
+
+func (l kitLogger) Log(keyvals ...interface{}) error {
+	msg := ""
+	verbosity := LogLevelDebug
+	values := make([]interface{}, 0, len(keyvals))
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{}
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		switch key {
+		case "msg":
+			msg = fmt.Sprint(value)
+		case "level":
+			if fmt.Sprint(value) == "debug" {
+				verbosity = LogLevelTrace
+			}
+		default:
+			values = append(values, key, redact(key, value))
+		}
+	}
+	l.log.V(verbosity).Info(msg, values...)
+	return nil
+}
+
+// logPKIMessage logs the decoded attributes of a pkiMessage at LogLevelTrace.
+// The challenge password of a CSR is only logged as redacted.
+func logPKIMessage(logger logr.Logger, msg string, pkiMessage *scep.PKIMessage) {
+	logger = logger.V(LogLevelTrace)
+	if !logger.Enabled() || pkiMessage == nil {
+		return
+	}
+	values := []interface{}{
+		"messageType", pkiMessage.MessageType.String(),
+		"transactionID", string(pkiMessage.TransactionID),
+		"senderNonce", hex.EncodeToString(pkiMessage.SenderNonce),
+	}
+	if rep := pkiMessage.CertRepMessage; rep != nil {
+		values = append(values,
+			"pkiStatus", pkiStatusName(rep.PKIStatus),
+			"recipientNonce", hex.EncodeToString(rep.RecipientNonce),
+		)
+		if rep.PKIStatus == scep.FAILURE {
+			values = append(values, "failInfo", string(rep.FailInfo))
+		}
+	}
+	if req := pkiMessage.CSRReqMessage; req != nil && req.CSR != nil {
+		values = append(values, "subject", req.CSR.Subject.String(), "dnsNames", req.CSR.DNSNames)
+		if challenge, err := x509util.ParseChallengePassword(req.CSR.Raw); err == nil && challenge != "" {
+			values = append(values, "challengePassword", redacted)
+		}
+	}
+	if len(pkiMessage.Recipients) > 0 {
+		values = append(values, "recipient", pkiMessage.Recipients[0].Subject.String())
+	}
+	if pkiMessage.SignerCert != nil {
+		values = append(values, "signer", pkiMessage.SignerCert.Subject.String())
+	}
+	logger.Info(msg, values...)
+}
+
+func pkiStatusName(status scep.PKIStatus) string {
+	switch status {
+	case scep.SUCCESS:
+		return "SUCCESS"
+	case scep.FAILURE:
+		return "FAILURE"
+	case scep.PENDING:
+		return "PENDING"
+	default:
+		return string(status)
+	}
+}
@@ -0,0 +1,96 @@
+package signer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// testLogSink collects the log lines of a logr.Logger.
+type testLogSink struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (s *testLogSink) logger(verbosity int) logr.Logger {
+	return funcr.New(func(prefix, args string) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.lines = append(s.lines, args)
+	}, funcr.Options{Verbosity: verbosity})
+}
+
+func (s *testLogSink) output() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strings.Join(s.lines, "\n")
+}
+
+func TestKitLogger(t *testing.T) {
+	sink := &testLogSink{}
+	logger := kitLogger{log: sink.logger(LogLevelDebug)}
+
+	require.Nil(t, level.Info(logger).Log("msg", "request", "op", "PKIOperation", "challengePassword", "secret"))
+	require.Nil(t, level.Debug(logger).Log("msg", "parsed scep pkiMessage"))
+
+	output := sink.output()
+	require.Contains(t, output, `"msg"="request"`)
+	require.Contains(t, output, `"op"="PKIOperation"`)
+	require.Contains(t, output, `"challengePassword"="<redacted>"`)
+	require.NotContains(t, output, "secret")
+	require.NotContains(t, output, "parsed scep pkiMessage", "debug lines are logged at the trace level")
+
+	sink = &testLogSink{}
+	logger = kitLogger{log: sink.logger(LogLevelTrace)}
+	require.Nil(t, level.Debug(logger).Log("msg", "parsed scep pkiMessage"))
+	require.Contains(t, sink.output(), "parsed scep pkiMessage")
+}
+
+func TestSignWithPrivateKeyLogsPKIMessages(t *testing.T) {
+	server := newTestSCEPServer(t)
+	sink := &testLogSink{}
+
+	signer, err := ScepSignerFromIssuerAndSecretData(sink.logger(LogLevelTrace), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("s3cr3t-challenge"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "log.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "tid-log")
+	require.Nil(t, err)
+
+	output := sink.output()
+	require.NotContains(t, output, "s3cr3t-challenge")
+	require.Contains(t, output, `"msg"="Sending pkiMessage."`)
+	require.Contains(t, output, `"challengePassword"="<redacted>"`)
+	require.Contains(t, output, `"subject"="CN=log.example.com"`)
+	require.Contains(t, output, `"msg"="Received pkiMessage."`)
+	require.Contains(t, output, `"pkiStatus"="SUCCESS"`)
+	require.Contains(t, output, `"transactionID"="tid-log"`)
+}
+
+func TestSignWithPrivateKeyLogsNothingByDefault(t *testing.T) {
+	server := newTestSCEPServer(t)
+	sink := &testLogSink{}
+
+	signer, err := ScepSignerFromIssuerAndSecretData(sink.logger(0), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("s3cr3t-challenge"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "log.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+	require.Empty(t, sink.output())
+}
@@ -0,0 +1,283 @@
+package signer
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"math/big"
+
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+)
+
+// SCEP attribute OIDs, see RFC 8894 section 3.2.1
+var (
+	oidSCEPmessageType   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 2}
+	oidSCEPsenderNonce   = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 5}
+	oidSCEPtransactionID = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 7}
+)
+
+// contentEncryptionAlgorithm is a block cipher used in CBC mode to encrypt the
+// pkiEnvelope of a message
+type contentEncryptionAlgorithm struct {
+	oid       asn1.ObjectIdentifier
+	keySize   int
+	newCipher func(key []byte) (cipher.Block, error)
+}
+
+var (
+	encryptionDESCBC    = contentEncryptionAlgorithm{pkcs7.OIDEncryptionAlgorithmDESCBC, 8, des.NewCipher}
+	encryptionDES3CBC   = contentEncryptionAlgorithm{pkcs7.OIDEncryptionAlgorithmDESEDE3CBC, 24, des.NewTripleDESCipher}
+	encryptionAES128CBC = contentEncryptionAlgorithm{pkcs7.OIDEncryptionAlgorithmAES128CBC, 16, aes.NewCipher}
+	encryptionAES256CBC = contentEncryptionAlgorithm{pkcs7.OIDEncryptionAlgorithmAES256CBC, 32, aes.NewCipher}
+)
+
+// pkiMessageTemplate holds the parameters to create a PKIMessage with. The scep
+// package always encrypts with the process wide pkcs7.ContentEncryptionAlgorithm
+// and signs with SHA-1, so messages are assembled here instead.
+type pkiMessageTemplate struct {
+	MessageType   scep.MessageType
+	TransactionID scep.TransactionID
+	Recipients    []*x509.Certificate
+	SignerCert    *x509.Certificate
+	SignerKey     *rsa.PrivateKey
+	Encryption    contentEncryptionAlgorithm
+	Digest        asn1.ObjectIdentifier
+}
+
+// newCSRRequest creates a PKCSReq, RenewalReq or UpdateReq message for csr.
+// Unless set in tmpl the transactionID is derived from the public key of csr.
+func newCSRRequest(csr *x509.CertificateRequest, tmpl *pkiMessageTemplate) (*scep.PKIMessage, error) {
+	if tmpl.TransactionID == "" {
+		tmpl.TransactionID = scep.TransactionID(transactionID("", csr))
+	}
+	msg, err := newPKIMessage(tmpl, csr.Raw)
+	if err != nil {
+		return nil, err
+	}
+	msg.CSRReqMessage = &scep.CSRReqMessage{
+		CSR: csr,
+	}
+	return msg, nil
+}
+
+// TransactionID derives the transactionID of an enrollment from seed, e.g. the
+// UID of the CertificateRequest, and the public key of the PEM encoded CSR. A
+// retried enrollment gets the same transactionID, so the SCEP server can
+// recognise it instead of issuing a second certificate.
+func TransactionID(seed string, csrBytes []byte) (string, error) {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return "", err
+	}
+	return transactionID(seed, csr), nil
+}
+
+func transactionID(seed string, csr *x509.CertificateRequest) string {
+	h := sha256.New()
+	h.Write([]byte(seed))
+	h.Write(csr.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// issuerAndSubject is the content of a CertPoll (GetCertInitial) message
+type issuerAndSubject struct {
+	Issuer  asn1.RawValue
+	Subject asn1.RawValue
+}
+
+// newCertPollRequest creates a CertPoll message that asks the SCEP server for
+// the result of the pending transaction in tmpl.
+func newCertPollRequest(issuer *x509.Certificate, csr *x509.CertificateRequest, tmpl *pkiMessageTemplate) (*scep.PKIMessage, error) {
+	content, err := asn1.Marshal(issuerAndSubject{
+		Issuer:  asn1.RawValue{FullBytes: issuer.RawSubject},
+		Subject: asn1.RawValue{FullBytes: csr.RawSubject},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "marshalling issuerAndSubject")
+	}
+	return newPKIMessage(tmpl, content)
+}
+
+// newPKIMessage encrypts content for the recipients and signs the result
+// together with the SCEP attributes.
+func newPKIMessage(tmpl *pkiMessageTemplate, content []byte) (*scep.PKIMessage, error) {
+	e7, err := encryptEnvelope(content, tmpl.Recipients, tmpl.Encryption)
+	if err != nil {
+		return nil, errors.Wrap(err, "encrypting pkiEnvelope")
+	}
+
+	sn, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+
+	signedData, err := pkcs7.NewSignedData(e7)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Digest != nil {
+		signedData.SetDigestAlgorithm(tmpl.Digest)
+	}
+	config := pkcs7.SignerInfoConfig{
+		ExtraSignedAttributes: []pkcs7.Attribute{
+			{
+				Type:  oidSCEPtransactionID,
+				Value: tmpl.TransactionID,
+			},
+			{
+				Type:  oidSCEPmessageType,
+				Value: tmpl.MessageType,
+			},
+			{
+				Type:  oidSCEPsenderNonce,
+				Value: sn,
+			},
+		},
+	}
+	if err := signedData.AddSigner(tmpl.SignerCert, tmpl.SignerKey, config); err != nil {
+		return nil, errors.Wrap(err, "signing pkiMessage")
+	}
+	raw, err := signedData.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	return &scep.PKIMessage{
+		Raw:           raw,
+		MessageType:   tmpl.MessageType,
+		TransactionID: tmpl.TransactionID,
+		SenderNonce:   sn,
+		Recipients:    tmpl.Recipients,
+		SignerKey:     tmpl.SignerKey,
+		SignerCert:    tmpl.SignerCert,
+	}, nil
+}
+
+func newNonce() (scep.SenderNonce, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "generating senderNonce")
+	}
+	return scep.SenderNonce(b), nil
+}
+
+// PKCS#7 EnvelopedData structures, see RFC 2315 section 10
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type envelopedData struct {
+	Version              int
+	RecipientInfos       []recipientInfo `asn1:"set"`
+	EncryptedContentInfo encryptedContentInfo
+}
+
+type recipientInfo struct {
+	Version                int
+	IssuerAndSerialNumber  issuerAndSerial
+	KeyEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedKey           []byte
+}
+
+type issuerAndSerial struct {
+	IssuerName   asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type encryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           asn1.RawValue `asn1:"tag:0,optional"`
+}
+
+// encryptEnvelope encrypts content with alg and a random key which is
+// encrypted for every recipient. pkcs7.Encrypt is not used because its cipher
+// is a package global and it cannot encrypt with DES3.
+func encryptEnvelope(content []byte, recipients []*x509.Certificate, alg contentEncryptionAlgorithm) ([]byte, error) {
+	if alg.oid == nil {
+		alg = encryptionDESCBC
+	}
+
+	key := make([]byte, alg.keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	block, err := alg.newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, block.BlockSize())
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	padded := pkcs5Pad(content, block.BlockSize())
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, padded)
+
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientInfos := make([]recipientInfo, len(recipients))
+	for i, recipient := range recipients {
+		pub, ok := recipient.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.Errorf("recipient %s has no RSA key", recipient.Subject)
+		}
+		encryptedKey, err := rsa.EncryptPKCS1v15(rand.Reader, pub, key)
+		if err != nil {
+			return nil, err
+		}
+		recipientInfos[i] = recipientInfo{
+			IssuerAndSerialNumber: issuerAndSerial{
+				IssuerName:   asn1.RawValue{FullBytes: recipient.RawIssuer},
+				SerialNumber: recipient.SerialNumber,
+			},
+			KeyEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm: pkcs7.OIDEncryptionAlgorithmRSA,
+			},
+			EncryptedKey: encryptedKey,
+		}
+	}
+
+	envelope, err := asn1.Marshal(envelopedData{
+		RecipientInfos: recipientInfos,
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType: pkcs7.OIDData,
+			ContentEncryptionAlgorithm: pkix.AlgorithmIdentifier{
+				Algorithm:  alg.oid,
+				Parameters: asn1.RawValue{FullBytes: ivParam},
+			},
+			EncryptedContent: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: encrypted},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{
+		ContentType: pkcs7.OIDEnvelopedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: envelope},
+	})
+}
+
+func pkcs5Pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+padding)
+	copy(padded, data)
+	for i := 0; i < padding; i++ {
+		padded = append(padded, byte(padding))
+	}
+	return padded
+}
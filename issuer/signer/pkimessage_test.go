@@ -0,0 +1,29 @@
+package signer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+)
+
+func TestEncryptEnvelope(t *testing.T) {
+	server := newTestSCEPServer(t)
+	content := []byte("pkiEnvelope content")
+
+	for _, alg := range []contentEncryptionAlgorithm{
+		encryptionDESCBC,
+		encryptionDES3CBC,
+		encryptionAES128CBC,
+		encryptionAES256CBC,
+	} {
+		e7, err := encryptEnvelope(content, server.caCertificates(), alg)
+		require.Nil(t, err)
+
+		p7, err := pkcs7.Parse(e7)
+		require.Nil(t, err, "algorithm: %s", alg.oid)
+		decrypted, err := p7.Decrypt(server.caCert, server.caKey)
+		require.Nil(t, err, "algorithm: %s", alg.oid)
+		require.Equal(t, content, decrypted)
+	}
+}
@@ -0,0 +1,63 @@
+package signer
+
+import (
+	"bytes"
+	"crypto/x509"
+
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/pkg/errors"
+	"go.mozilla.org/pkcs7"
+)
+
+// Errors returned if a CertRep response does not belong to the request it
+// answers, e.g. because it was replayed or sent for another transaction.
+var (
+	// ErrResponseSigner is returned if a response is not signed by the pinned
+	// RA signing certificate, or the CA if there is no RA.
+	ErrResponseSigner = errors.New("response is not signed by the SCEP server")
+	// ErrResponseSignature is returned if the signature of a response is
+	// invalid.
+	ErrResponseSignature = errors.New("invalid response signature")
+	// ErrTransactionIDMismatch is returned if the transactionID of a response
+	// differs from the one of the request.
+	ErrTransactionIDMismatch = errors.New("response transactionID does not match the request")
+	// ErrRecipientNonceMismatch is returned if the recipientNonce of a
+	// response does not echo the senderNonce of the request.
+	ErrRecipientNonceMismatch = errors.New("response recipientNonce does not match the request senderNonce")
+)
+
+// verifyResponseSignature checks that the PKIMessage data is signed by signer
+// only and that the signature is valid.
+func verifyResponseSignature(data []byte, signer *x509.Certificate) error {
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return errors.Wrap(err, "parsing pkiMessage response")
+	}
+	if len(p7.Signers) != 1 {
+		return errors.WithMessagef(ErrResponseSigner, "response has %d signers", len(p7.Signers))
+	}
+	sid := p7.Signers[0].IssuerAndSerialNumber
+	if !bytes.Equal(sid.IssuerName.FullBytes, signer.RawIssuer) || sid.SerialNumber == nil || sid.SerialNumber.Cmp(signer.SerialNumber) != 0 {
+		return errors.WithMessagef(ErrResponseSigner, "expected %q with serial %s", signer.Subject, signer.SerialNumber)
+	}
+	// certificates sent with the response are not trusted
+	p7.Certificates = []*x509.Certificate{signer}
+	if err := p7.Verify(); err != nil {
+		return errors.WithMessage(ErrResponseSignature, err.Error())
+	}
+	return nil
+}
+
+// verifyResponse checks that the CertRep resp answers req.
+func verifyResponse(req, resp *scep.PKIMessage) error {
+	if resp.MessageType != scep.CertRep {
+		return errors.Errorf("unexpected response messageType %s", resp.MessageType)
+	}
+	if resp.TransactionID != req.TransactionID {
+		return errors.WithMessagef(ErrTransactionIDMismatch, "expected %s, got %s", req.TransactionID, resp.TransactionID)
+	}
+	if resp.CertRepMessage == nil || !bytes.Equal(resp.RecipientNonce, req.SenderNonce) {
+		return ErrRecipientNonceMismatch
+	}
+	return nil
+}
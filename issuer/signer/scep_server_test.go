@@ -0,0 +1,373 @@
+package signer
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/stretchr/testify/require"
+	"go.mozilla.org/pkcs7"
+)
+
+var (
+	oidSCEPpkiStatus      = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 3}
+	oidSCEPfailInfo       = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 4}
+	oidSCEPrecipientNonce = asn1.ObjectIdentifier{2, 16, 840, 1, 113733, 1, 9, 6}
+)
+
+// testSCEPServer is a minimal in-process SCEP server. Unlike the scepserver of
+// the scep module it can answer requests with PENDING and understands CertPoll
+// messages.
+type testSCEPServer struct {
+	*httptest.Server
+
+	caCert *x509.Certificate
+	caKey  *rsa.PrivateKey
+	caps   string
+	// raSignCert and raEncryptCert are sent with the CA certificate if set.
+	// Requests are then decrypted with the RA encryption key and responses
+	// signed with the RA signing key, like NDES does.
+	raSignCert    *x509.Certificate
+	raSignKey     *rsa.PrivateKey
+	raEncryptCert *x509.Certificate
+	raEncryptKey  *rsa.PrivateKey
+	// signWithCA makes the server sign responses with the CA key even if it
+	// has an RA
+	signWithCA bool
+	// forgeTransactionID, forgeRecipientNonce and forgeSignature make the
+	// server answer with a response that does not belong to the request
+	forgeTransactionID  bool
+	forgeRecipientNonce bool
+	forgeSignature      bool
+
+	mtx sync.Mutex
+	// pending is the number of PKIOperations answered with PENDING before
+	// the certificate is issued
+	pending int
+	// failInfo makes every PKIOperation fail if set
+	failInfo scep.FailInfo
+	// now is the time the certificates messages are signed with have to be
+	// valid at, time.Now if nil. Other messages fail with badMessageCheck.
+	now      func() time.Time
+	csrs     map[scep.TransactionID]*x509.CertificateRequest
+	messages []testSCEPMessage
+	// caIdentifiers are the messages received with GetCACaps and GetCACert
+	caIdentifiers []string
+}
+
+// testSCEPMessage is a PKIOperation message received by the testSCEPServer
+type testSCEPMessage struct {
+	Method        string
+	MessageType   scep.MessageType
+	TransactionID scep.TransactionID
+	SenderNonce   scep.SenderNonce
+	Signer        *x509.Certificate
+	Digest        asn1.ObjectIdentifier
+	Encryption    asn1.ObjectIdentifier
+	// Recipients are the serial numbers of the certificates the envelope is
+	// encrypted to
+	Recipients []*big.Int
+	Content    []byte
+}
+
+func newTestSCEPServer(t *testing.T) *testSCEPServer {
+	caCert, caKey := newTestCertificate(t, "test SCEP CA", true, x509.KeyUsageCertSign|x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, nil, nil)
+
+	s := &testSCEPServer{
+		caCert: caCert,
+		caKey:  caKey,
+		caps:   "Renewal\nSHA-1\nSHA-256\nAES\nDES3\nSCEPStandard\nPOSTPKIOperation",
+		csrs:   map[scep.TransactionID]*x509.CertificateRequest{},
+	}
+	s.Server = httptest.NewServer(s)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testSCEPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := r.URL.Query().Get("operation")
+	if operation == "GetCACaps" || operation == "GetCACert" {
+		s.mtx.Lock()
+		s.caIdentifiers = append(s.caIdentifiers, r.URL.Query().Get("message"))
+		s.mtx.Unlock()
+	}
+	switch operation {
+	case "GetCACaps":
+		w.Write([]byte(s.caps))
+	case "GetCACert":
+		if s.raSignCert == nil {
+			w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+			w.Write(s.caCert.Raw)
+			return
+		}
+		certs, err := scep.DegenerateCertificates([]*x509.Certificate{s.raSignCert, s.raEncryptCert, s.caCert})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-x509-ca-ra-cert")
+		w.Write(certs)
+	case "PKIOperation":
+		var body []byte
+		var err error
+		if r.Method == http.MethodPost {
+			body, err = io.ReadAll(r.Body)
+		} else {
+			body, err = base64.URLEncoding.DecodeString(r.URL.Query().Get("message"))
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := s.pkiOperation(r.Method, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/x-pki-message")
+		w.Write(resp)
+	default:
+		http.Error(w, "unknown operation", http.StatusBadRequest)
+	}
+}
+
+func (s *testSCEPServer) pkiOperation(method string, data []byte) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	p7, err := pkcs7.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := p7.Verify(); err != nil {
+		return nil, err
+	}
+	msg := testSCEPMessage{Method: method}
+	if err := p7.UnmarshalSignedAttribute(oidSCEPmessageType, &msg.MessageType); err != nil {
+		return nil, err
+	}
+	if err := p7.UnmarshalSignedAttribute(oidSCEPtransactionID, &msg.TransactionID); err != nil {
+		return nil, err
+	}
+	if err := p7.UnmarshalSignedAttribute(oidSCEPsenderNonce, &msg.SenderNonce); err != nil {
+		return nil, err
+	}
+	msg.Signer = p7.GetOnlySigner()
+	msg.Digest = p7.Signers[0].DigestAlgorithm.Algorithm
+	envelopeInfo, err := parseEnvelope(p7.Content)
+	if err != nil {
+		return nil, err
+	}
+	msg.Encryption = envelopeInfo.EncryptedContentInfo.ContentEncryptionAlgorithm.Algorithm
+	for _, recipient := range envelopeInfo.RecipientInfos {
+		msg.Recipients = append(msg.Recipients, recipient.IssuerAndSerialNumber.SerialNumber)
+	}
+	envelope, err := pkcs7.Parse(p7.Content)
+	if err != nil {
+		return nil, err
+	}
+	recipientCert, recipientKey := s.caCert, s.caKey
+	if s.raEncryptCert != nil {
+		recipientCert, recipientKey = s.raEncryptCert, s.raEncryptKey
+	}
+	if msg.Content, err = envelope.Decrypt(recipientCert, recipientKey); err != nil {
+		return nil, err
+	}
+	s.messages = append(s.messages, msg)
+
+	now := time.Now()
+	if s.now != nil {
+		now = s.now()
+	}
+	if now.Before(msg.Signer.NotBefore) || now.After(msg.Signer.NotAfter) {
+		return s.certRep(msg, scep.FAILURE, scep.BadMessageCheck, nil)
+	}
+
+	if msg.MessageType != scep.CertPoll {
+		csr, err := x509.ParseCertificateRequest(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		s.csrs[msg.TransactionID] = csr
+	}
+
+	switch {
+	case s.failInfo != "":
+		return s.certRep(msg, scep.FAILURE, s.failInfo, nil)
+	case s.pending > 0:
+		s.pending--
+		return s.certRep(msg, scep.PENDING, "", nil)
+	}
+
+	csr, ok := s.csrs[msg.TransactionID]
+	if !ok {
+		return s.certRep(msg, scep.FAILURE, scep.BadCertID, nil)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(int64(len(s.messages) + 1)),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return s.certRep(msg, scep.SUCCESS, "", cert)
+}
+
+func (s *testSCEPServer) certRep(req testSCEPMessage, status scep.PKIStatus, failInfo scep.FailInfo, cert *x509.Certificate) ([]byte, error) {
+	var content []byte
+	if cert != nil {
+		deg, err := scep.DegenerateCertificates([]*x509.Certificate{cert})
+		if err != nil {
+			return nil, err
+		}
+		if content, err = pkcs7.Encrypt(deg, []*x509.Certificate{req.Signer}); err != nil {
+			return nil, err
+		}
+	}
+	sn, err := newNonce()
+	if err != nil {
+		return nil, err
+	}
+	tID, rn := req.TransactionID, req.SenderNonce
+	if s.forgeTransactionID {
+		tID = "forged"
+	}
+	if s.forgeRecipientNonce {
+		rn = sn
+	}
+	attrs := []pkcs7.Attribute{
+		{Type: oidSCEPtransactionID, Value: tID},
+		{Type: oidSCEPpkiStatus, Value: status},
+		{Type: oidSCEPmessageType, Value: scep.CertRep},
+		{Type: oidSCEPsenderNonce, Value: sn},
+		{Type: oidSCEPrecipientNonce, Value: rn},
+	}
+	if failInfo != "" {
+		attrs = append(attrs, pkcs7.Attribute{Type: oidSCEPfailInfo, Value: failInfo})
+	}
+	sd, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, err
+	}
+	signerCert, signerKey := s.caCert, s.caKey
+	if s.raSignCert != nil && !s.signWithCA {
+		signerCert, signerKey = s.raSignCert, s.raSignKey
+	}
+	if s.forgeSignature {
+		// the signer identifies as signerCert but signs with another key
+		if signerKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, err
+		}
+	}
+	if err := sd.AddSigner(signerCert, signerKey, pkcs7.SignerInfoConfig{ExtraSignedAttributes: attrs}); err != nil {
+		return nil, err
+	}
+	return sd.Finish()
+}
+
+// useRA lets the server send separate RA signing and encryption certificates
+// issued by the CA.
+func (s *testSCEPServer) useRA(t *testing.T) {
+	s.raSignCert, s.raSignKey = newTestCertificate(t, "test SCEP RA signing", false, x509.KeyUsageDigitalSignature, s.caCert, s.caKey)
+	s.raEncryptCert, s.raEncryptKey = newTestCertificate(t, "test SCEP RA encryption", false, x509.KeyUsageKeyEncipherment, s.caCert, s.caKey)
+}
+
+// parseEnvelope parses a PKCS#7 EnvelopedData
+func parseEnvelope(data []byte) (*envelopedData, error) {
+	var info contentInfo
+	if _, err := asn1.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	var envelope envelopedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &envelope); err != nil {
+		return nil, err
+	}
+	return &envelope, nil
+}
+
+func (s *testSCEPServer) caCertificates() []*x509.Certificate {
+	return []*x509.Certificate{s.caCert}
+}
+
+func (s *testSCEPServer) receivedCAIdentifiers() []string {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]string(nil), s.caIdentifiers...)
+}
+
+func (s *testSCEPServer) receivedMessages() []testSCEPMessage {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return append([]testSCEPMessage(nil), s.messages...)
+}
+
+// newTestCSR returns a PEM encoded CSR and its private key
+func newTestCSR(t *testing.T, commonName string) ([]byte, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return newTestCSRWithKey(t, commonName, key), key
+}
+
+// newTestCSRWithKey returns a PEM encoded CSR for key
+func newTestCSRWithKey(t *testing.T, commonName string, key crypto.Signer) []byte {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: csrPEMBlockType, Bytes: der})
+}
+
+// newTestCertificateDER creates a self-signed certificate from tmpl and
+// returns its DER encoding.
+func newTestCertificateDER(t *testing.T, tmpl *x509.Certificate, key *rsa.PrivateKey) []byte {
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	return der
+}
+
+// newTestCertificate creates a certificate and its key. The certificate is
+// self-signed if parent is nil.
+func newTestCertificate(t *testing.T, commonName string, isCA bool, keyUsage x509.KeyUsage, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              keyUsage,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
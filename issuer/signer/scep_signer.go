@@ -2,20 +2,27 @@ package signer
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/asn1"
 	"encoding/pem"
-	"os"
+	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log/level"
+	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/go-logr/logr"
 	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/mheers/scep-external-issuer/issuer/metrics"
 	"github.com/pkg/errors"
 
-	scepclient "github.com/micromdm/scep/v2/client"
 	"github.com/micromdm/scep/v2/scep"
+	scepserver "github.com/micromdm/scep/v2/server"
 )
 
 const (
@@ -23,67 +30,121 @@ const (
 	csrPEMBlockType         = "CERTIFICATE REQUEST"
 )
 
-func ScepSignerFromIssuerAndSecretData(issuerSpec *scepissuerapi.SCEPIssuerSpec, data map[string][]byte) (Signer, error) {
-	challenge := string(data["challenge"])
-	return &scepSigner{
-		URL:       issuerSpec.URL,
-		Challenge: challenge,
-	}, nil
+func ScepSignerFromIssuerAndSecretData(log logr.Logger, issuerSpec *scepissuerapi.SCEPIssuerSpec, issuerStatus *scepissuerapi.SCEPIssuerStatus, data map[string][]byte) (Signer, error) {
+	return newScepSigner(log, issuerSpec, issuerStatus, data)
 }
 
-type scepSigner struct {
-	URL       string
-	Challenge string
-	Log       logr.Logger
+func ScepHealthCheckerFromIssuerAndSecretData(log logr.Logger, issuerSpec *scepissuerapi.SCEPIssuerSpec, data map[string][]byte) (HealthChecker, error) {
+	return newScepSigner(log, issuerSpec, nil, data)
+}
+
+func newScepSigner(log logr.Logger, issuerSpec *scepissuerapi.SCEPIssuerSpec, issuerStatus *scepissuerapi.SCEPIssuerStatus, data map[string][]byte) (*scepSigner, error) {
+	httpClient, err := newHTTPClient(issuerSpec.TLS, data)
+	if err != nil {
+		return nil, err
+	}
+	challenge := string(data["challenge"])
+	s := &scepSigner{
+		URL:            issuerSpec.URL,
+		CAIdentifier:   issuerSpec.CAIdentifier,
+		CAFingerprints: issuerSpec.CAFingerprints,
+		CABundle:       issuerSpec.CABundle,
+		Challenge:      challenge,
+		Encryption:     issuerSpec.ContentEncryptionAlgorithm,
+		Digest:         issuerSpec.DigestAlgorithm,
+		Log:            log.WithName("scep").WithValues("url", issuerSpec.URL),
+		Timeout:        DefaultTimeout,
+		HTTPClient:     httpClient,
+
+		SignerCertificateLifetime: defaultSignerCertificateLifetime,
+	}
+	if issuerSpec.Timeout != nil && issuerSpec.Timeout.Duration > 0 {
+		s.Timeout = issuerSpec.Timeout.Duration
+	}
+	if issuerSpec.MaxPendingDuration != nil && issuerSpec.MaxPendingDuration.Duration > 0 {
+		s.SignerCertificateLifetime += issuerSpec.MaxPendingDuration.Duration
+	}
+	if issuerStatus != nil {
+		s.Capabilities = Capabilities(issuerStatus.Capabilities)
+	}
+	return s, nil
 }
 
-func (o *scepSigner) Check() error {
-	return nil
+type scepSigner struct {
+	URL string
+	// CAIdentifier selects the CA of a SCEP server which hosts several CAs.
+	CAIdentifier string
+	// CAFingerprints and CABundle pin the certificates GetCACert may return.
+	CAFingerprints []string
+	CABundle       []byte
+	Challenge      string
+	// Capabilities of the SCEP server. They are queried with GetCACaps on the
+	// first request if empty.
+	Capabilities Capabilities
+	// Encryption and Digest override the algorithms chosen from the
+	// capabilities if set.
+	Encryption scepissuerapi.ContentEncryptionAlgorithm
+	Digest     scepissuerapi.DigestAlgorithm
+	// Timeout is how long every HTTP request to the SCEP server may take.
+	Timeout time.Duration
+	// SignerCertificateLifetime is how long the self-signed certificate the
+	// messages are signed with is valid. The certificate is kept to poll for
+	// a pending request, so it has to outlive the time the request may be
+	// pending.
+	SignerCertificateLifetime time.Duration
+	// HTTPClient sends the requests to the SCEP server with the TLS
+	// configuration of the issuer.
+	HTTPClient *http.Client
+	// Log is the logger of the reconcile the signer is used in. The
+	// challenge is never logged.
+	Log logr.Logger
 }
 
-func (o *scepSigner) SignWithPrivateKey(csrBytes []byte, key *rsa.PrivateKey) ([]byte, error) {
-	// // mkdir
-	// err := os.MkdirAll("/tmp/csr", 0755)
-	// if err != nil {
-	// 	return nil, err
-	// }
+// DefaultTimeout is the timeout of HTTP requests to the SCEP server if the
+// issuer does not configure one.
+const DefaultTimeout = 30 * time.Second
 
-	// // writes csr to file
-	// csrFile, err := os.Create(fmt.Sprintf("/tmp/csr/%s.pem", time.Now().Format("2006-01-02_15:04:05")))
-	// if err != nil {
-	// 	return nil, errors.Wrap(err, "failed to create csr file")
-	// }
-	// defer csrFile.Close()
-	// csrFile.Write(csrBytes)
+// defaultSignerCertificateLifetime is how long a self-signed signer
+// certificate is valid on top of the maximum pending duration of the issuer.
+// A request without a maximum pending duration may be polled for as long.
+const defaultSignerCertificateLifetime = 365 * 24 * time.Hour
 
-	ctx := context.Background()
-	logger := log.NewJSONLogger(log.NewSyncWriter(os.Stdout))
+// ErrUnreachable is returned if the SCEP server does not answer GetCACaps or
+// GetCACert.
+var ErrUnreachable = errors.New("the SCEP server is unreachable")
 
-	csr, err := AddChallenge(csrBytes, o.Challenge, key)
+// Check contacts the SCEP server like an enrollment does. It returns an error
+// if the server is unreachable, its CA certificates are not valid or do not
+// match the pinned ones, or it does not advertise the configured algorithms.
+func (o *scepSigner) Check(ctx context.Context) (*ServerInfo, error) {
+	client, err := newSCEPClient(o.URL, o.HTTPClient, o.Log, o.Timeout)
 	if err != nil {
 		return nil, err
 	}
 
-	csrAugmented, err := parseCSR(csr)
+	caps, err := o.capabilities(ctx, client)
 	if err != nil {
 		return nil, err
 	}
-
-	signerCert, err := signCSR(key, csrAugmented)
-	if err != nil {
+	if _, _, err := caps.algorithms(o.Encryption, o.Digest); err != nil {
 		return nil, err
 	}
 
-	// create a client connection to the scep server
-	client, err := scepclient.New(o.URL, logger)
+	caCerts, err := o.caCertificates(ctx, client)
 	if err != nil {
 		return nil, err
 	}
+	info := caCerts.info()
+	info.Capabilities = caps
+	return info, nil
+}
 
-	caCertMsg := "" // TODO: message sent with GetCACert operation
-	resp, certNum, err := client.GetCACert(ctx, caCertMsg)
+// caCertificates gets the CA certificates with GetCACert, checks that they are
+// valid and verifies them against the pinned fingerprints and CA bundle.
+func (o *scepSigner) caCertificates(ctx context.Context, client *scepserver.Endpoints) (*caCertificates, error) {
+	resp, certNum, err := client.GetCACert(ctx, o.CAIdentifier)
 	if err != nil {
-		return nil, err
+		return nil, errors.WithMessagef(ErrUnreachable, "GetCACert: %v", err)
 	}
 
 	var certs []*x509.Certificate
@@ -100,86 +161,395 @@ func (o *scepSigner) SignWithPrivateKey(csrBytes []byte, key *rsa.PrivateKey) ([
 			}
 		}
 	}
+	caCerts, err := classifyCACertificates(certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := caCerts.checkValidity(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := caCerts.verify(o.CAFingerprints, o.CABundle); err != nil {
+		return nil, err
+	}
+	return caCerts, nil
+}
 
-	// var msgType scep.MessageType
-	// {
-	// 	// TODO validate CA and set UpdateReq if needed
-	// 	if cert != nil {
-	// 		msgType = scep.RenewalReq
-	// 	} else {
-	// 		msgType = scep.PKCSReq
-	// 	}
-	// }
+// capabilities returns the capabilities of the SCEP server and queries them
+// once if they are not known yet.
+func (o *scepSigner) capabilities(ctx context.Context, client *scepserver.Endpoints) (Capabilities, error) {
+	if len(o.Capabilities) > 0 {
+		return o.Capabilities, nil
+	}
+	// client.GetCACaps cannot send a CA identifier
+	response, err := client.GetEndpoint(ctx, scepserver.SCEPRequest{Operation: "GetCACaps", Message: []byte(o.CAIdentifier)})
+	if err == nil {
+		err = response.(scepserver.SCEPResponse).Err
+	}
+	if err != nil {
+		return nil, errors.WithMessagef(ErrUnreachable, "GetCACaps: %v", err)
+	}
+	o.Capabilities = ParseCapabilities(response.(scepserver.SCEPResponse).Data)
+	return o.Capabilities, nil
+}
 
-	var msgType scep.MessageType = scep.PKCSReq
-	// signerCert := cert
+func (o *scepSigner) SignWithPrivateKey(ctx context.Context, csrBytes []byte, key crypto.Signer, transactionID string) (*SignedCertificate, error) {
+	return o.enroll(ctx, csrBytes, key, nil, nil, transactionID)
+}
 
-	// generate a signer certificate request
+func (o *scepSigner) RenewWithPrivateKey(ctx context.Context, csrBytes []byte, key crypto.Signer, certBytes []byte, transactionID string) (*SignedCertificate, error) {
+	cert, err := parseCert(certBytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "parsing certificate to renew")
+	}
+	return o.enroll(ctx, csrBytes, key, cert, nil, transactionID)
+}
 
-	tmpl := &scep.PKIMessage{
-		MessageType: msgType,
-		Recipients:  certs,
-		SignerKey:   key,
-		SignerCert:  signerCert,
+func (o *scepSigner) PollWithPrivateKey(ctx context.Context, csrBytes []byte, key crypto.Signer, state *PendingState) (*SignedCertificate, error) {
+	if state == nil {
+		return nil, errors.New("no pending state to poll for")
+	}
+	return o.enroll(ctx, csrBytes, key, nil, state, "")
+}
+
+// enroll sends a new PKCSReq for csrBytes or, if pending is set, polls the
+// SCEP server for the result of the pending transaction. If existing can be
+// renewed, a RenewalReq signed by existing is sent instead of the PKCSReq.
+// New requests are sent with transactionID unless it is empty. It returns a
+// *PendingError if the server has not decided on the request yet.
+//
+// The response can only be encrypted to an RSA key, so for other keys the
+// messages are signed with a transient RSA key and a self-signed certificate,
+// while the CSR keeps its own public key. If key is nil, the CSR is sent
+// unchanged in a message signed with a transient RSA key.
+func (o *scepSigner) enroll(ctx context.Context, csrBytes []byte, key crypto.Signer, existing *x509.Certificate, pending *PendingState, transactionID string) (*SignedCertificate, error) {
+	logger := o.Log
+
+	// create a client connection to the scep server
+	client, err := newSCEPClient(o.URL, o.HTTPClient, logger, o.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	caps, err := o.capabilities(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	encryption, digest, err := caps.algorithms(o.Encryption, o.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	caCerts, err := o.caCertificates(ctx, client)
+	if err != nil {
+		return nil, err
 	}
 
-	if o.Challenge != "" && msgType == scep.PKCSReq {
-		tmpl.CSRReqMessage = &scep.CSRReqMessage{
-			ChallengePassword: o.Challenge,
+	if existing != nil {
+		if err := renewable(existing, key, caCerts.All, caps); err != nil {
+			logger.Info("Cannot renew the existing certificate, sending a PKCSReq instead.", "reason", err.Error())
+			existing = nil
 		}
 	}
 
-	// TODO: maybe pass also a scep.WithCertsSelector(cfg.caCertsSelector) option
-	msg, err := scep.NewCSRRequest(csrAugmented, tmpl, scep.WithLogger(logger))
+	msgKey, transient, err := envelopeKey(key, pending)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating csr pkiMessage")
+		return nil, err
+	}
+	if key == nil && pending == nil && o.Challenge != "" {
+		logger.Info("The challenge password is not added to the CSR, it cannot be signed again without its private key.")
 	}
 
-	var respMsg *scep.PKIMessage
+	var msg *scep.PKIMessage
+	var signerCert *x509.Certificate
+	switch {
+	case pending == nil && existing != nil:
+		msg, signerCert, err = o.newRenewalRequest(csrBytes, msgKey, existing, caCerts, encryption, digest, transactionID)
+	case pending == nil:
+		msg, signerCert, err = o.newCSRRequest(csrBytes, key, msgKey, caCerts, encryption, digest, transactionID)
+	default:
+		msg, signerCert, err = o.newCertPollRequest(csrBytes, msgKey, caCerts, encryption, digest, pending)
+	}
+	if err != nil {
+		return nil, err
+	}
+	msgType := msg.MessageType
+	logger = logger.WithValues("messageType", msgType.String(), "transactionID", string(msg.TransactionID))
+	logPKIMessage(logger, "Sending pkiMessage.", msg)
 
-	for {
-		// loop in case we get a PENDING response which requires
-		// a manual approval.
+	respBytes, err := pkiOperation(ctx, client, caps, msg.Raw)
+	if err != nil {
+		return nil, errors.Wrapf(err, "PKIOperation for %s", msgType)
+	}
 
-		respBytes, err := client.PKIOperation(ctx, msg.Raw)
-		if err != nil {
-			return nil, errors.Wrapf(err, "PKIOperation for %s", msgType)
-		}
+	// responses have to be signed by the RA, or the CA if there is no RA
+	if err := verifyResponseSignature(respBytes, caCerts.Signer); err != nil {
+		return nil, errors.Wrapf(err, "verifying pkiMessage response %s", msgType)
+	}
+	respMsg, err := scep.ParsePKIMessage(respBytes, scep.WithLogger(kitLogger{log: logger}), scep.WithCACerts([]*x509.Certificate{caCerts.Signer}))
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing pkiMessage response %s", msgType)
+	}
+	logPKIMessage(logger, "Received pkiMessage.", respMsg)
+	if err := verifyResponse(msg, respMsg); err != nil {
+		return nil, errors.Wrapf(err, "verifying pkiMessage response %s", msgType)
+	}
 
-		respMsg, err = scep.ParsePKIMessage(respBytes, scep.WithLogger(logger), scep.WithCACerts(msg.Recipients))
-		if err != nil {
-			return nil, errors.Wrapf(err, "parsing pkiMessage response %s", msgType)
+	switch respMsg.PKIStatus {
+	case scep.FAILURE:
+		logger.V(LogLevelDebug).Info("The server rejected the request.", "pkiStatus", "FAILURE", "failInfo", string(respMsg.FailInfo))
+		failure := &FailureError{MessageType: msgType, FailInfo: respMsg.FailInfo}
+		if transient && (respMsg.FailInfo == scep.BadMessageCheck || respMsg.FailInfo == scep.BadRequest) {
+			// the message was not signed with the key of the CSR
+			failure.Err = ErrProofOfPossession
 		}
-
-		switch respMsg.PKIStatus {
-		case scep.FAILURE:
-			return nil, errors.Errorf("%s request failed, failInfo: %s", msgType, respMsg.FailInfo)
-		case scep.PENDING:
-			logger.Log("pkiStatus", "PENDING", "msg", "sleeping for 30 seconds, then trying again.")
-			time.Sleep(30 * time.Second)
-			continue
+		return nil, failure
+	case scep.PENDING:
+		// the server needs more time, e.g. for a manual approval. Instead of
+		// blocking here the caller polls again later with the returned state.
+		logger.V(LogLevelDebug).Info("The request is pending, poll again later.", "pkiStatus", "PENDING")
+		state := PendingState{
+			TransactionID:     string(msg.TransactionID),
+			SignerCertificate: pemCert(signerCert.Raw),
+		}
+		if transient {
+			state.SignerKey = pemKey(msgKey)
 		}
-		logger.Log("pkiStatus", "SUCCESS", "msg", "server returned a certificate.")
-		break // on scep.SUCCESS
+		return nil, &PendingError{State: state}
 	}
+	logger.V(LogLevelDebug).Info("The server returned a certificate.", "pkiStatus", "SUCCESS")
 
-	if err := respMsg.DecryptPKIEnvelope(signerCert, key); err != nil {
+	if err := respMsg.DecryptPKIEnvelope(signerCert, msgKey); err != nil {
 		return nil, errors.Wrapf(err, "decrypt pkiEnvelope, msgType: %s, status %s", msgType, respMsg.PKIStatus)
 	}
 
 	respCert := respMsg.CertRepMessage.Certificate
 
-	return pemCert(respCert.Raw), nil
+	signed := &SignedCertificate{
+		Certificate: pemCert(respCert.Raw),
+	}
+	for _, ca := range caChain(respCert, caCerts.All) {
+		signed.CAChain = append(signed.CAChain, pemCert(ca.Raw)...)
+	}
+	return signed, nil
+}
+
+// newCSRRequest creates the PKCSReq message for a new enrollment and returns
+// it together with the self-signed certificate it is signed with. The CSR is
+// signed with key, the message with msgKey. If key is nil, the CSR is sent
+// as it is.
+func (o *scepSigner) newCSRRequest(csrBytes []byte, key crypto.Signer, msgKey *rsa.PrivateKey, caCerts *caCertificates, encryption contentEncryptionAlgorithm, digest asn1.ObjectIdentifier, transactionID string) (*scep.PKIMessage, *x509.Certificate, error) {
+	csr := csrBytes
+	if key != nil {
+		var err error
+		if csr, err = AddChallenge(csrBytes, o.Challenge, key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	csrAugmented, err := parseCSR(csr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signerCert, err := signCSR(msgKey, csrAugmented, o.SignerCertificateLifetime)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := newCSRRequest(csrAugmented, &pkiMessageTemplate{
+		MessageType:   scep.PKCSReq,
+		TransactionID: scep.TransactionID(transactionID),
+		Recipients:    []*x509.Certificate{caCerts.Recipient},
+		SignerCert:    signerCert,
+		SignerKey:     msgKey,
+		Encryption:    encryption,
+		Digest:        digest,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating csr pkiMessage")
+	}
+	return msg, signerCert, nil
+}
+
+// newRenewalRequest creates the RenewalReq message for csrBytes which is
+// signed with the certificate to renew. The existing certificate authenticates
+// the request, so no challenge password is added.
+func (o *scepSigner) newRenewalRequest(csrBytes []byte, key *rsa.PrivateKey, existing *x509.Certificate, caCerts *caCertificates, encryption contentEncryptionAlgorithm, digest asn1.ObjectIdentifier, transactionID string) (*scep.PKIMessage, *x509.Certificate, error) {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg, err := newCSRRequest(csr, &pkiMessageTemplate{
+		MessageType:   scep.RenewalReq,
+		TransactionID: scep.TransactionID(transactionID),
+		Recipients:    []*x509.Certificate{caCerts.Recipient},
+		SignerCert:    existing,
+		SignerKey:     key,
+		Encryption:    encryption,
+		Digest:        digest,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating renewal pkiMessage")
+	}
+	return msg, existing, nil
 }
 
-func (o *scepSigner) Sign(csrBytes []byte) ([]byte, error) {
-	// generate a random rsa2048 key for the SCEP client
-	key, err := rsa.GenerateKey(rand.Reader, 2048)
+// newCertPollRequest creates the CertPoll message for a pending transaction
+// and returns it together with the certificate of the original request.
+func (o *scepSigner) newCertPollRequest(csrBytes []byte, key *rsa.PrivateKey, caCerts *caCertificates, encryption contentEncryptionAlgorithm, digest asn1.ObjectIdentifier, pending *PendingState) (*scep.PKIMessage, *x509.Certificate, error) {
+	csr, err := parseCSR(csrBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signerCert, err := parseCert(pending.SignerCertificate)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "parsing signer certificate of pending request")
+	}
+
+	msg, err := newCertPollRequest(caCerts.CA, csr, &pkiMessageTemplate{
+		MessageType:   scep.CertPoll,
+		TransactionID: scep.TransactionID(pending.TransactionID),
+		Recipients:    []*x509.Certificate{caCerts.Recipient},
+		SignerCert:    signerCert,
+		SignerKey:     key,
+		Encryption:    encryption,
+		Digest:        digest,
+	})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "creating certPoll pkiMessage")
+	}
+	return msg, signerCert, nil
+}
+
+// Sign requests a certificate for csrBytes without its private key. The
+// request is signed with a transient RSA key like for non-RSA keys.
+func (o *scepSigner) Sign(ctx context.Context, csrBytes []byte, transactionID string) (*SignedCertificate, error) {
+	return o.enroll(ctx, csrBytes, nil, nil, nil, transactionID)
+}
+
+// renewable returns an error if cert cannot sign a RenewalReq: the server has
+// to support renewal and cert has to be valid, issued by one of the CA
+// certificates and belong to key.
+func renewable(cert *x509.Certificate, key crypto.Signer, certs []*x509.Certificate, caps Capabilities) error {
+	if !caps.Supports(CapRenewal) {
+		return errors.New("the SCEP server does not support renewal")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("the response to a RenewalReq can only be decrypted with an RSA key")
+	}
+	now := time.Now()
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return errors.Errorf("the certificate is not valid at %s", now.Format(time.RFC3339))
+	}
+	if !rsaKey.PublicKey.Equal(cert.PublicKey) {
+		return errors.New("the certificate does not belong to the private key")
+	}
+	for _, ca := range certs {
+		if cert.CheckSignatureFrom(ca) == nil {
+			return nil
+		}
+	}
+	return errors.New("the certificate is not issued by the CA of the SCEP server")
+}
+
+// envelopeKey returns the RSA key the messages are signed with and the
+// response is encrypted to. It is key itself if key is an RSA key, otherwise,
+// also if key is nil, the transient key of the pending transaction or a new
+// one.
+func envelopeKey(key crypto.Signer, pending *PendingState) (*rsa.PrivateKey, bool, error) {
+	if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+		return rsaKey, false, nil
+	}
+	if pending != nil {
+		if len(pending.SignerKey) == 0 {
+			return nil, false, errors.New("pending state has no signer key")
+		}
+		rsaKey, err := parseKey(pending.SignerKey)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "parsing signer key of pending request")
+		}
+		return rsaKey, true, nil
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, false, err
+	}
+	return rsaKey, true, nil
+}
+
+// newSCEPClient creates the endpoints of the SCEP server at url. Unlike
+// scepclient.New the endpoints are returned directly so the HTTP method of a
+// PKIOperation can be chosen from the known capabilities. Like
+// scepserver.MakeClientEndpoints, which cannot be given an HTTP client, a URL
+// without scheme is requested with plain HTTP.
+func newSCEPClient(instance string, client *http.Client, log logr.Logger, timeout time.Duration) (*scepserver.Endpoints, error) {
+	if !strings.HasPrefix(instance, "http") {
+		instance = "http://" + instance
+	}
+	tgt, err := url.Parse(instance)
 	if err != nil {
 		return nil, err
 	}
+	var options []httptransport.ClientOption
+	if client != nil {
+		options = append(options, httptransport.SetClient(client))
+	}
+	endpoints := &scepserver.Endpoints{
+		GetEndpoint:  httptransport.NewClient("GET", tgt, scepserver.EncodeSCEPRequest, scepserver.DecodeSCEPResponse, options...).Endpoint(),
+		PostEndpoint: httptransport.NewClient("POST", tgt, scepserver.EncodeSCEPRequest, scepserver.DecodeSCEPResponse, options...).Endpoint(),
+	}
+	logger := level.Info(kitLogger{log: log})
+	endpoints.GetEndpoint = timeoutMiddleware(timeout)(operationMetricsMiddleware(scepserver.EndpointLoggingMiddleware(logger)(endpoints.GetEndpoint)))
+	endpoints.PostEndpoint = timeoutMiddleware(timeout)(operationMetricsMiddleware(scepserver.EndpointLoggingMiddleware(logger)(endpoints.PostEndpoint)))
+	return endpoints, nil
+}
 
-	return o.SignWithPrivateKey(csrBytes, key)
+// timeoutMiddleware aborts every request to the SCEP server after timeout.
+func timeoutMiddleware(timeout time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, request)
+		}
+	}
+}
+
+// operationMetricsMiddleware records the duration of every SCEP operation.
+func operationMetricsMiddleware(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		operation := "unknown"
+		if req, ok := request.(scepserver.SCEPRequest); ok {
+			operation = req.Operation
+		}
+		defer func(begin time.Time) {
+			if err == nil {
+				if resp, ok := response.(scepserver.SCEPResponse); ok {
+					err = resp.Err
+				}
+			}
+			metrics.ObserveOperation(operation, err, time.Since(begin))
+		}(time.Now())
+		return next(ctx, request)
+	}
+}
+
+// pkiOperation sends msg with POST if the server supports it and with GET
+// otherwise.
+func pkiOperation(ctx context.Context, client *scepserver.Endpoints, caps Capabilities, msg []byte) ([]byte, error) {
+	e := client.GetEndpoint
+	if caps.Supports(CapPOSTPKIOperation) {
+		e = client.PostEndpoint
+	}
+	response, err := e(ctx, scepserver.SCEPRequest{Operation: "PKIOperation", Message: msg})
+	if err != nil {
+		return nil, err
+	}
+	resp := response.(scepserver.SCEPResponse)
+	return resp.Data, resp.Err
 }
 
 func pemCert(derBytes []byte) []byte {
@@ -192,8 +562,15 @@ func pemCert(derBytes []byte) []byte {
 	return out
 }
 
-func signCSR(priv *rsa.PrivateKey, csr *x509.CertificateRequest) (*x509.Certificate, error) {
-	self, err := selfSign(priv, csr)
+func pemKey(key *rsa.PrivateKey) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+}
+
+func signCSR(priv *rsa.PrivateKey, csr *x509.CertificateRequest, lifetime time.Duration) (*x509.Certificate, error) {
+	self, err := selfSign(priv, csr, lifetime)
 	if err != nil {
 		return nil, err
 	}
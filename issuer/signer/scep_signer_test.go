@@ -1,13 +1,33 @@
 package signer
 
 import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	logrtesting "github.com/go-logr/logr/testing"
 	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
 	"github.com/stretchr/testify/require"
 
 	"github.com/micromdm/scep/v2/cryptoutil/x509util"
+	"github.com/micromdm/scep/v2/scep"
+	"go.mozilla.org/pkcs7"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
@@ -132,7 +152,7 @@ func TestSignScepSignerFromIssuerAndSecretData(t *testing.T) {
 	data := map[string][]byte{
 		"challenge": []byte("secret"),
 	}
-	signer, err := ScepSignerFromIssuerAndSecretData(issuerSpec, data)
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, data)
 	require.Nil(t, err)
 	require.NotNil(t, signer)
 
@@ -148,7 +168,7 @@ func TestSignScepSignerFromIssuerAndSecretData(t *testing.T) {
 	key, err := parseKeyPKCS8(keyCertManager)
 	require.Nil(t, err)
 
-	signed, err := signer.SignWithPrivateKey(csrPEM, key)
+	signed, err := signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
 	require.Nil(t, err)
 	require.NotNil(t, signed)
 }
@@ -187,3 +207,653 @@ func TestAddChallenge(t *testing.T) {
 	require.Nil(t, err)
 	require.Equal(t, "secret", challenge)
 }
+
+func TestAddChallengeKeyTypes(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.Nil(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	for _, key := range []crypto.Signer{ecdsaKey, ed25519Key} {
+		csrPEM := newTestCSRWithKey(t, "challenge.example.com", key)
+		augmentedCSRPEM, err := AddChallenge(csrPEM, "secret", key)
+		require.Nil(t, err, "key: %T", key)
+
+		csr, err := parseCSR(augmentedCSRPEM)
+		require.Nil(t, err)
+		require.Nil(t, csr.CheckSignature(), "key: %T", key)
+		require.Equal(t, "challenge.example.com", csr.Subject.CommonName)
+		challenge, err := x509util.ParseChallengePassword(csr.Raw)
+		require.Nil(t, err)
+		require.Equal(t, "secret", challenge)
+	}
+}
+
+func TestSignWithPrivateKeyPending(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.pending = 2
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "pending.example.com")
+
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	var pendingErr *PendingError
+	require.ErrorAs(t, err, &pendingErr)
+	require.NotEmpty(t, pendingErr.State.TransactionID)
+
+	// still pending, the state of the transaction does not change
+	_, err = signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+	var stillPendingErr *PendingError
+	require.ErrorAs(t, err, &stillPendingErr)
+	require.Equal(t, pendingErr.State, stillPendingErr.State)
+
+	signed, err := signer.PollWithPrivateKey(context.Background(), csrPEM, key, &stillPendingErr.State)
+	require.Nil(t, err)
+	cert, err := parseCert(signed.Certificate)
+	require.Nil(t, err)
+	require.Equal(t, "pending.example.com", cert.Subject.CommonName)
+	require.Equal(t, pemCert(server.caCert.Raw), signed.CAChain)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 3)
+	require.Equal(t, scep.MessageType(scep.PKCSReq), messages[0].MessageType)
+	for _, msg := range messages[1:] {
+		require.Equal(t, scep.MessageType(scep.CertPoll), msg.MessageType)
+		require.Equal(t, messages[0].TransactionID, msg.TransactionID)
+
+		var content issuerAndSubject
+		_, err := asn1.Unmarshal(msg.Content, &content)
+		require.Nil(t, err)
+		require.Equal(t, server.caCert.RawSubject, content.Issuer.FullBytes)
+	}
+}
+
+func TestPollWithPrivateKeyAfterAnHour(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.pending = 1
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL:                server.URL + "/scep",
+		MaxPendingDuration: &metav1.Duration{Duration: 30 * 24 * time.Hour},
+	}, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "pending.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	var pendingErr *PendingError
+	require.ErrorAs(t, err, &pendingErr)
+
+	// the signer certificate of the transaction is still valid when the
+	// request is polled for at the end of the maximum pending duration
+	server.mtx.Lock()
+	server.now = func() time.Time { return time.Now().Add(30*24*time.Hour + time.Hour) }
+	server.mtx.Unlock()
+	signed, err := signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+	require.Nil(t, err)
+	cert, err := parseCert(signed.Certificate)
+	require.Nil(t, err)
+	require.Equal(t, "pending.example.com", cert.Subject.CommonName)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	require.Equal(t, messages[0].Signer.Raw, messages[1].Signer.Raw)
+}
+
+func TestSignWithPrivateKeyNonRSA(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	require.Nil(t, err)
+
+	for _, key := range []crypto.Signer{ecdsaKey, ed25519Key} {
+		server := newTestSCEPServer(t)
+		server.pending = 1
+
+		signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+			URL: server.URL + "/scep",
+		}, nil, map[string][]byte{
+			"challenge": []byte("secret"),
+		})
+		require.Nil(t, err)
+
+		csrPEM := newTestCSRWithKey(t, "non-rsa.example.com", key)
+		_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+		var pendingErr *PendingError
+		require.ErrorAs(t, err, &pendingErr, "key: %T", key)
+		require.NotEmpty(t, pendingErr.State.SignerKey)
+
+		signed, err := signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+		require.Nil(t, err, "key: %T", key)
+		cert, err := parseCert(signed.Certificate)
+		require.Nil(t, err)
+		require.Equal(t, key.Public(), cert.PublicKey)
+
+		// the messages are signed with the transient RSA key, the CSR
+		// with the key of the certificate
+		messages := server.receivedMessages()
+		require.Len(t, messages, 2)
+		require.IsType(t, &rsa.PublicKey{}, messages[0].Signer.PublicKey)
+		require.Equal(t, messages[0].Signer.Raw, messages[1].Signer.Raw)
+		csr, err := x509.ParseCertificateRequest(messages[0].Content)
+		require.Nil(t, err)
+		require.Nil(t, csr.CheckSignature())
+		require.Equal(t, key.Public(), csr.PublicKey)
+
+		// RenewalReqs cannot be answered for the key, a PKCSReq is sent
+		_, err = signer.RenewWithPrivateKey(context.Background(), csrPEM, key, signed.Certificate, "")
+		require.Nil(t, err)
+		require.Equal(t, scep.MessageType(scep.PKCSReq), server.receivedMessages()[2].MessageType)
+	}
+}
+
+func TestSignKeyless(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.pending = 1
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "keyless.example.com")
+	_, err = signer.Sign(context.Background(), csrPEM, "keyless-transaction")
+	var pendingErr *PendingError
+	require.ErrorAs(t, err, &pendingErr)
+	require.Equal(t, "keyless-transaction", pendingErr.State.TransactionID)
+	require.NotEmpty(t, pendingErr.State.SignerKey)
+
+	signed, err := signer.PollWithPrivateKey(context.Background(), csrPEM, nil, &pendingErr.State)
+	require.Nil(t, err)
+	cert, err := parseCert(signed.Certificate)
+	require.Nil(t, err)
+	require.Equal(t, key.Public(), cert.PublicKey)
+
+	// the CSR is sent unchanged in messages signed with the transient key
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	require.False(t, key.PublicKey.Equal(messages[0].Signer.PublicKey))
+	require.Equal(t, messages[0].Signer.Raw, messages[1].Signer.Raw)
+	block, _ := pem.Decode(csrPEM)
+	require.Equal(t, block.Bytes, messages[0].Content)
+}
+
+func TestSignWithPrivateKeyProofOfPossession(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.failInfo = scep.BadMessageCheck
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	_, err = signer.SignWithPrivateKey(context.Background(), newTestCSRWithKey(t, "pop.example.com", key), key, "")
+	require.ErrorIs(t, err, ErrProofOfPossession)
+	var failureErr *FailureError
+	require.ErrorAs(t, err, &failureErr)
+	require.True(t, failureErr.Permanent())
+
+	// requests signed with the key of the CSR fail for other reasons
+	csrPEM, rsaKey := newTestCSR(t, "pop.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, rsaKey, "")
+	require.ErrorAs(t, err, &failureErr)
+	require.NotErrorIs(t, err, ErrProofOfPossession)
+}
+
+func TestPollWithPrivateKeyFailure(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.pending = 1
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "rejected.example.com")
+
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	var pendingErr *PendingError
+	require.ErrorAs(t, err, &pendingErr)
+
+	server.failInfo = scep.BadRequest
+	_, err = signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+	require.False(t, errors.As(err, &pendingErr))
+	var failureErr *FailureError
+	require.ErrorAs(t, err, &failureErr)
+	require.Equal(t, scep.MessageType(scep.CertPoll), failureErr.MessageType)
+	require.Equal(t, scep.FailInfo(scep.BadRequest), failureErr.FailInfo)
+	require.True(t, failureErr.Permanent())
+
+	// the server may accept the request once the clocks are in sync
+	server.failInfo = scep.BadTime
+	_, err = signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+	require.ErrorAs(t, err, &failureErr)
+	require.False(t, failureErr.Permanent())
+}
+
+func TestSignWithPrivateKeyCapabilities(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.caps = "DES3\nSHA-1"
+
+	issuerSpec := &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "caps.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+	require.Equal(t, Capabilities{CapDES3, CapSHA1}, signer.(*scepSigner).Capabilities)
+
+	// capabilities recorded in the issuer status are used without asking the
+	// server again
+	signer, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, &scepissuerapi.SCEPIssuerStatus{
+		Capabilities: []string{CapPOSTPKIOperation},
+	}, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	require.Equal(t, "GET", messages[0].Method)
+	require.Equal(t, "POST", messages[1].Method)
+}
+
+func TestSignWithPrivateKeyConfiguredAlgorithms(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.caps = "AES\nDES3\nSHA-256\nSHA-512"
+
+	issuerSpec := &scepissuerapi.SCEPIssuerSpec{
+		URL:                        server.URL + "/scep",
+		ContentEncryptionAlgorithm: scepissuerapi.ContentEncryptionAES256CBC,
+		DigestAlgorithm:            scepissuerapi.DigestSHA256,
+	}
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "algorithms.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 1)
+	require.Equal(t, encryptionAES256CBC.oid, messages[0].Encryption)
+	require.Equal(t, pkcs7.OIDDigestAlgorithmSHA256, messages[0].Digest)
+
+	// without configured algorithms the strongest advertised ones are used
+	signer, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+
+	messages = server.receivedMessages()
+	require.Len(t, messages, 2)
+	require.Equal(t, encryptionAES128CBC.oid, messages[1].Encryption)
+	require.Equal(t, pkcs7.OIDDigestAlgorithmSHA512, messages[1].Digest)
+
+	// the request is not sent if the server does not advertise the algorithm
+	server.caps = "DES3\nSHA-1"
+	signer, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.ErrorIs(t, err, ErrAlgorithmNotAdvertised)
+	require.Len(t, server.receivedMessages(), 2)
+}
+
+func TestRenewWithPrivateKey(t *testing.T) {
+	server := newTestSCEPServer(t)
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "renew.example.com")
+	signed, err := signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+	existing, err := parseCert(signed.Certificate)
+	require.Nil(t, err)
+
+	renewed, err := signer.RenewWithPrivateKey(context.Background(), csrPEM, key, signed.Certificate, "")
+	require.Nil(t, err)
+	cert, err := parseCert(renewed.Certificate)
+	require.Nil(t, err)
+	require.Equal(t, "renew.example.com", cert.Subject.CommonName)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	require.Equal(t, scep.MessageType(scep.PKCSReq), messages[0].MessageType)
+	require.Equal(t, scep.MessageType(scep.RenewalReq), messages[1].MessageType)
+	require.Equal(t, existing.Raw, messages[1].Signer.Raw)
+
+	// a certificate of another CA is not renewed
+	otherServer := newTestSCEPServer(t)
+	signer, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: otherServer.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = signer.RenewWithPrivateKey(context.Background(), csrPEM, key, signed.Certificate, "")
+	require.Nil(t, err)
+
+	// nor is a certificate if the server does not support renewal
+	server.caps = "POSTPKIOperation"
+	signer, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = signer.RenewWithPrivateKey(context.Background(), csrPEM, key, signed.Certificate, "")
+	require.Nil(t, err)
+
+	messages = append(otherServer.receivedMessages(), server.receivedMessages()[2:]...)
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		require.Equal(t, scep.MessageType(scep.PKCSReq), msg.MessageType)
+		require.NotEqual(t, existing.Raw, msg.Signer.Raw)
+	}
+}
+
+func TestCAChain(t *testing.T) {
+	root, rootKey := newTestCertificate(t, "root", true, 0, nil, nil)
+	intermediate, intermediateKey := newTestCertificate(t, "intermediate", true, 0, root, rootKey)
+	ra, _ := newTestCertificate(t, "ra", false, 0, intermediate, intermediateKey)
+	leaf, _ := newTestCertificate(t, "leaf", false, 0, intermediate, intermediateKey)
+
+	require.Equal(t, []*x509.Certificate{intermediate, root}, caChain(leaf, []*x509.Certificate{ra, root, intermediate}))
+	require.Equal(t, []*x509.Certificate{intermediate}, caChain(leaf, []*x509.Certificate{ra, intermediate}))
+	require.Empty(t, caChain(leaf, []*x509.Certificate{ra, root}))
+}
+
+func TestSignWithPrivateKeyRA(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.useRA(t)
+	server.pending = 1
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "ra.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	var pendingErr *PendingError
+	require.ErrorAs(t, err, &pendingErr)
+
+	signed, err := signer.PollWithPrivateKey(context.Background(), csrPEM, key, &pendingErr.State)
+	require.Nil(t, err)
+	require.Equal(t, pemCert(server.caCert.Raw), signed.CAChain)
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		require.Equal(t, []*big.Int{server.raEncryptCert.SerialNumber}, msg.Recipients)
+	}
+	var content issuerAndSubject
+	_, err = asn1.Unmarshal(messages[1].Content, &content)
+	require.Nil(t, err)
+	require.Equal(t, server.caCert.RawSubject, content.Issuer.FullBytes)
+
+	checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, map[string][]byte{})
+	require.Nil(t, err)
+	info, err := checker.Check(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, server.caCert.Subject.String(), info.CA.Subject)
+	require.Len(t, info.RA, 2)
+	require.Equal(t, server.raEncryptCert.Subject.String(), info.RA[0].Subject)
+	require.Equal(t, server.raSignCert.Subject.String(), info.RA[1].Subject)
+}
+
+func TestSignWithPrivateKeyRASignature(t *testing.T) {
+	server := newTestSCEPServer(t)
+	server.useRA(t)
+	// responses have to be signed by the RA signing certificate, not by
+	// any of the certificates from GetCACert
+	server.signWithCA = true
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "ra.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.ErrorIs(t, err, ErrResponseSigner)
+}
+
+func TestSignWithPrivateKeyResponseMismatch(t *testing.T) {
+	tests := map[string]struct {
+		forge       func(*testSCEPServer)
+		expectedErr error
+	}{
+		"transaction-id": {
+			forge:       func(s *testSCEPServer) { s.forgeTransactionID = true },
+			expectedErr: ErrTransactionIDMismatch,
+		},
+		"recipient-nonce": {
+			forge:       func(s *testSCEPServer) { s.forgeRecipientNonce = true },
+			expectedErr: ErrRecipientNonceMismatch,
+		},
+		"signature": {
+			forge:       func(s *testSCEPServer) { s.forgeSignature = true },
+			expectedErr: ErrResponseSignature,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestSCEPServer(t)
+			tc.forge(server)
+
+			signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+				URL: server.URL + "/scep",
+			}, nil, map[string][]byte{})
+			require.Nil(t, err)
+
+			csrPEM, key := newTestCSR(t, "forged.example.com")
+			_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+			require.ErrorIs(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestSignWithPrivateKeyTransactionID(t *testing.T) {
+	server := newTestSCEPServer(t)
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	csrPEM, key := newTestCSR(t, "retry.example.com")
+	transactionID, err := TransactionID("uid-1", csrPEM)
+	require.Nil(t, err)
+	other, err := TransactionID("uid-2", csrPEM)
+	require.Nil(t, err)
+	require.NotEqual(t, transactionID, other)
+
+	// a retry of the same enrollment reuses the transactionID
+	for i := 0; i < 2; i++ {
+		retried, err := TransactionID("uid-1", csrPEM)
+		require.Nil(t, err)
+		require.Equal(t, transactionID, retried)
+		_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, retried)
+		require.Nil(t, err)
+	}
+
+	messages := server.receivedMessages()
+	require.Len(t, messages, 2)
+	for _, msg := range messages {
+		require.Equal(t, scep.TransactionID(transactionID), msg.TransactionID)
+	}
+}
+
+func TestSignWithPrivateKeyCAIdentifier(t *testing.T) {
+	server := newTestSCEPServer(t)
+
+	issuerSpec := &scepissuerapi.SCEPIssuerSpec{
+		URL:          server.URL + "/scep",
+		CAIdentifier: "ManagementCA",
+	}
+	checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.Nil(t, err)
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, map[string][]byte{})
+	require.Nil(t, err)
+	csrPEM, key := newTestCSR(t, "ca-identifier.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.Nil(t, err)
+
+	// GetCACaps and GetCACert of the health check and of the signer
+	require.Equal(t, []string{"ManagementCA", "ManagementCA", "ManagementCA", "ManagementCA"}, server.receivedCAIdentifiers())
+}
+
+func TestSignWithPrivateKeyCAFingerprintMismatch(t *testing.T) {
+	server := newTestSCEPServer(t)
+	other, _ := newTestCertificate(t, "other", true, x509.KeyUsageCertSign, nil, nil)
+
+	issuerSpec := &scepissuerapi.SCEPIssuerSpec{
+		URL:      server.URL + "/scep",
+		CABundle: pemCert(other.Raw),
+	}
+	checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.ErrorIs(t, err, ErrCAFingerprintMismatch)
+
+	// the challenge is not sent to a server with other CA certificates
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, nil, map[string][]byte{
+		"challenge": []byte("secret"),
+	})
+	require.Nil(t, err)
+	csrPEM, key := newTestCSR(t, "pinned.example.com")
+	_, err = signer.SignWithPrivateKey(context.Background(), csrPEM, key, "")
+	require.ErrorIs(t, err, ErrCAFingerprintMismatch)
+	require.Empty(t, server.receivedMessages())
+
+	issuerSpec.CABundle = pemCert(server.caCert.Raw)
+	checker, err = ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.Nil(t, err)
+}
+
+func TestCheck(t *testing.T) {
+	server := newTestSCEPServer(t)
+	issuerSpec := &scepissuerapi.SCEPIssuerSpec{
+		URL: server.URL + "/scep",
+	}
+	checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	info, err := checker.Check(context.Background())
+	require.Nil(t, err)
+	fingerprint := sha256.Sum256(server.caCert.Raw)
+	require.Equal(t, CertificateInfo{
+		Subject:     "CN=test SCEP CA",
+		Fingerprint: hex.EncodeToString(fingerprint[:]),
+		NotAfter:    server.caCert.NotAfter,
+	}, info.CA)
+	require.Empty(t, info.RA)
+	require.True(t, info.Capabilities.Supports(CapRenewal))
+	require.True(t, info.Capabilities.Supports(CapPOSTPKIOperation))
+
+	// the server does not advertise SHA-512
+	issuerSpec.DigestAlgorithm = scepissuerapi.DigestSHA512
+	checker, err = ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.ErrorIs(t, err, ErrAlgorithmNotAdvertised)
+	issuerSpec.DigestAlgorithm = ""
+
+	// the CA certificate is expired
+	expired := *server.caCert
+	expired.NotAfter = time.Now().Add(-time.Minute)
+	expired.Raw = newTestCertificateDER(t, &expired, server.caKey)
+	server.caCert = &expired
+	checker, err = ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.ErrorIs(t, err, ErrCACertificateNotValid)
+
+	server.Close()
+	checker, err = ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), issuerSpec, map[string][]byte{})
+	require.Nil(t, err)
+	_, err = checker.Check(context.Background())
+	require.ErrorIs(t, err, ErrUnreachable)
+}
+
+// newHangingSCEPServer returns the URL of a server which answers no request
+// before it is closed.
+func newHangingSCEPServer(t *testing.T) string {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(func() {
+		close(release)
+		server.Close()
+	})
+	return server.URL + "/scep"
+}
+
+func TestTimeout(t *testing.T) {
+	url := newHangingSCEPServer(t)
+
+	checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL:     url,
+		Timeout: &metav1.Duration{Duration: 100 * time.Millisecond},
+	}, map[string][]byte{})
+	require.Nil(t, err)
+
+	start := time.Now()
+	_, err = checker.Check(context.Background())
+	require.ErrorIs(t, err, ErrUnreachable)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: url,
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+	require.Equal(t, DefaultTimeout, signer.(*scepSigner).Timeout)
+}
+
+func TestContextCancellation(t *testing.T) {
+	url := newHangingSCEPServer(t)
+
+	signer, err := ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+		URL: url,
+	}, nil, map[string][]byte{})
+	require.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	csrPEM, key := newTestCSR(t, "cancel.example.com")
+	start := time.Now()
+	_, err = signer.SignWithPrivateKey(ctx, csrPEM, key, "")
+	require.ErrorIs(t, err, ErrUnreachable)
+	require.Less(t, time.Since(start), DefaultTimeout)
+}
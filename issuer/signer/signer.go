@@ -1,40 +1,155 @@
 package signer
 
 import (
-	"crypto/rsa"
+	"context"
+	"crypto"
 	"encoding/pem"
+	"fmt"
 	"time"
 
+	"github.com/go-logr/logr"
 	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/pkg/errors"
 	capi "k8s.io/api/certificates/v1beta1"
 )
 
+// HealthChecker checks that the SCEP server of an issuer can be used and
+// describes its CA and RA certificates.
 type HealthChecker interface {
-	Check() error
+	Check(context.Context) (*ServerInfo, error)
 }
 
-type HealthCheckerBuilder func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (HealthChecker, error)
+// ServerInfo describes the SCEP server found by a HealthChecker.
+type ServerInfo struct {
+	// CA is the certificate of the CA which issues the certificates.
+	CA CertificateInfo
+	// RA are the RA certificates if the server has an RA.
+	RA []CertificateInfo
+	// Capabilities are the capabilities the server advertised with
+	// GetCACaps.
+	Capabilities Capabilities
+}
+
+// CertificateInfo describes a CA or RA certificate of a SCEP server.
+type CertificateInfo struct {
+	Subject string
+	// Fingerprint is the hex encoded SHA-256 fingerprint of the certificate.
+	Fingerprint string
+	NotAfter    time.Time
+}
+
+type HealthCheckerBuilder func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, map[string][]byte) (HealthChecker, error)
 
+// Signer enrolls certificates at a SCEP server. Cancelling the context aborts
+// the requests to the server.
 type Signer interface {
-	Sign([]byte) ([]byte, error)
-	SignWithPrivateKey([]byte, *rsa.PrivateKey) ([]byte, error)
+	// Sign requests a certificate for the PEM encoded CSR without its private
+	// key. The CSR is sent unchanged in a request signed with a transient RSA
+	// key, so no challenge password can be added to it. The transactionID is
+	// used like in SignWithPrivateKey.
+	Sign(context.Context, []byte, string) (*SignedCertificate, error)
+	// SignWithPrivateKey requests a certificate for the PEM encoded CSR in a
+	// transaction with the given transactionID, see TransactionID. If it is
+	// empty, the transactionID is derived from the public key of the CSR.
+	SignWithPrivateKey(context.Context, []byte, crypto.Signer, string) (*SignedCertificate, error)
+	// RenewWithPrivateKey renews the PEM encoded certificate, which belongs
+	// to the private key, with a RenewalReq. If the certificate cannot be
+	// renewed, a new one is requested like in SignWithPrivateKey.
+	RenewWithPrivateKey(context.Context, []byte, crypto.Signer, []byte, string) (*SignedCertificate, error)
+	// PollWithPrivateKey polls for the result of a pending request. The
+	// private key is nil for requests sent with Sign.
+	PollWithPrivateKey(context.Context, []byte, crypto.Signer, *PendingState) (*SignedCertificate, error)
+}
+
+// SignedCertificate is a certificate issued by a Signer together with the
+// certificates of the CA that issued it.
+type SignedCertificate struct {
+	// Certificate is the PEM encoded issued certificate.
+	Certificate []byte
+	// CAChain holds the PEM encoded certificates of the issuing CA and its
+	// parents up to the root CA, if the Signer knows them.
+	CAChain []byte
+}
+
+// PendingState holds everything needed to resume a SCEP transaction which the
+// server answered with PENDING, e.g. because it waits for a manual approval.
+type PendingState struct {
+	// TransactionID identifies the transaction at the SCEP server.
+	TransactionID string
+	// SignerCertificate is the PEM encoded certificate the pending request was
+	// signed with. Polls have to be signed with the same certificate.
+	SignerCertificate []byte
+	// SignerKey is the PEM encoded transient RSA key of SignerCertificate. It
+	// is only set if the private key of the CSR is not an RSA key or the
+	// request was sent with Sign. It does not protect any secret, the response
+	// only carries the certificate.
+	SignerKey []byte
+}
+
+// PendingError is returned by a Signer when the SCEP server accepted a request
+// but has not issued the certificate yet. State has to be passed to
+// PollWithPrivateKey later to fetch the result.
+type PendingError struct {
+	State PendingState
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("request is pending, transactionID: %s", e.State.TransactionID)
+}
+
+// ErrProofOfPossession is the likely cause of a rejected request for a CSR with
+// a non-RSA key. Such requests are signed with a transient RSA key, which CAs
+// that require proof-of-possession by the key of the CSR do not accept.
+var ErrProofOfPossession = errors.New("the SCEP server may require the request to be signed with the key of the CSR")
+
+// FailureError is returned by a Signer when the SCEP server answered a request
+// with pkiStatus FAILURE.
+type FailureError struct {
+	MessageType scep.MessageType
+	FailInfo    scep.FailInfo
+	// Err is the likely cause of the failure if it is known
+	Err error
+}
+
+func (e *FailureError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s request failed, failInfo: %s: %v", e.MessageType, e.FailInfo, e.Err)
+	}
+	return fmt.Sprintf("%s request failed, failInfo: %s", e.MessageType, e.FailInfo)
+}
+
+func (e *FailureError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent reports whether the server will reject the request again. A
+// badTime failure can be resolved, e.g. once the clocks are in sync, so the
+// request is worth retrying.
+func (e *FailureError) Permanent() bool {
+	switch e.FailInfo {
+	case scep.BadAlg, scep.BadMessageCheck, scep.BadRequest, scep.BadCertID:
+		return true
+	default:
+		return false
+	}
 }
 
-type SignerBuilder func(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (Signer, error)
+type SignerBuilder func(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (Signer, error)
 
-func ExampleHealthCheckerFromIssuerAndSecretData(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (HealthChecker, error) {
+func ExampleHealthCheckerFromIssuerAndSecretData(logr.Logger, *scepissuerapi.SCEPIssuerSpec, map[string][]byte) (HealthChecker, error) {
 	return &exampleSigner{}, nil
 }
 
-func ExampleSignerFromIssuerAndSecretData(*scepissuerapi.SCEPIssuerSpec, map[string][]byte) (Signer, error) {
+func ExampleSignerFromIssuerAndSecretData(logr.Logger, *scepissuerapi.SCEPIssuerSpec, *scepissuerapi.SCEPIssuerStatus, map[string][]byte) (Signer, error) {
 	return &exampleSigner{}, nil
 }
 
 type exampleSigner struct {
 }
 
-func (o *exampleSigner) Check() error {
-	return nil
+func (o *exampleSigner) Check(context.Context) (*ServerInfo, error) {
+	return nil, nil
 }
 
 var (
@@ -89,7 +204,7 @@ YcXl/jdU/2nHdY6r7m6xIapxs0hdDMF/lML2SszUIukZw73NJp3x7L9enCY=
 	duration = time.Hour * 24 * 365
 )
 
-func (o *exampleSigner) SignWithPrivateKey(csrBytes []byte, key *rsa.PrivateKey) ([]byte, error) {
+func (o *exampleSigner) SignWithPrivateKey(_ context.Context, csrBytes []byte, key crypto.Signer, _ string) (*SignedCertificate, error) {
 	csr, err := parseCSR(csrBytes)
 	if err != nil {
 		return nil, err
@@ -112,17 +227,34 @@ func (o *exampleSigner) SignWithPrivateKey(csrBytes []byte, key *rsa.PrivateKey)
 	if err != nil {
 		return nil, err
 	}
-	return pem.EncodeToMemory(&pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: crtDER,
-	}), nil
+	return &SignedCertificate{
+		Certificate: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crtDER,
+		}),
+		CAChain: pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: cert.Raw,
+		}),
+	}, nil
+
+}
 
+func (o *exampleSigner) RenewWithPrivateKey(ctx context.Context, csrBytes []byte, key crypto.Signer, _ []byte, transactionID string) (*SignedCertificate, error) {
+	return o.SignWithPrivateKey(ctx, csrBytes, key, transactionID)
+}
+
+func (o *exampleSigner) PollWithPrivateKey(ctx context.Context, csrBytes []byte, key crypto.Signer, _ *PendingState) (*SignedCertificate, error) {
+	if key == nil {
+		return o.Sign(ctx, csrBytes, "")
+	}
+	return o.SignWithPrivateKey(ctx, csrBytes, key, "")
 }
 
-func (o *exampleSigner) Sign(csrBytes []byte) ([]byte, error) {
+func (o *exampleSigner) Sign(ctx context.Context, csrBytes []byte, _ string) (*SignedCertificate, error) {
 	key, err := parseKey(keyPEM)
 	if err != nil {
 		return nil, err
 	}
-	return o.SignWithPrivateKey(csrBytes, key)
+	return o.SignWithPrivateKey(ctx, csrBytes, key, "")
 }
@@ -0,0 +1,65 @@
+package signer
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/pkg/errors"
+)
+
+// Keys of the client certificate and key in the secret data passed to the
+// builders. They are the keys of a kubernetes.io/tls Secret.
+const (
+	ClientCertificateKey = "tls.crt"
+	ClientKeyKey         = "tls.key"
+)
+
+// ErrTLSConfig is returned if the TLS configuration of an issuer is invalid.
+var ErrTLSConfig = errors.New("invalid TLS configuration")
+
+// newHTTPClient returns the HTTP client for the SCEP server. It is
+// http.DefaultClient unless config is set. The client certificate and key are
+// read from data if config names a client certificate Secret.
+//
+// A signer is built for every reconcile, so its transport does not keep
+// connections alive, which would otherwise stay open after the signer is done.
+func newHTTPClient(config *scepissuerapi.TLSConfig, data map[string][]byte) (*http.Client, error) {
+	if config == nil {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: config.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	switch config.MinVersion {
+	case "", scepissuerapi.TLSVersion12:
+	case scepissuerapi.TLSVersion13:
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, errors.WithMessagef(ErrTLSConfig, "unsupported minimum TLS version %q", config.MinVersion)
+	}
+
+	if len(config.CABundle) > 0 {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(config.CABundle) {
+			return nil, errors.WithMessage(ErrTLSConfig, "no certificates found in the CA bundle")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	if config.ClientCertificateSecretName != "" {
+		cert, err := tls.X509KeyPair(data[ClientCertificateKey], data[ClientKeyKey])
+		if err != nil {
+			return nil, errors.WithMessagef(ErrTLSConfig, "client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.DisableKeepAlives = true
+	return &http.Client{Transport: transport}, nil
+}
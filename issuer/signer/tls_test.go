@@ -0,0 +1,222 @@
+package signer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	logrtesting "github.com/go-logr/logr/testing"
+	scepissuerapi "github.com/mheers/scep-external-issuer/api/v1alpha1"
+	"github.com/micromdm/scep/v2/scep"
+	"github.com/stretchr/testify/require"
+)
+
+// testTLSName is the only name in the HTTPS certificate of the servers of
+// newTestTLSSCEPServer, so it has to be set as ServerName.
+const testTLSName = "scep.example.com"
+
+// newTestTLSSCEPServer starts a testSCEPServer with HTTPS. configure may
+// change the TLS configuration of the server. It returns the server and the
+// PEM encoded CA certificate its HTTPS certificate is issued by.
+func newTestTLSSCEPServer(t *testing.T, configure func(*tls.Config)) (*testSCEPServer, []byte) {
+	caCert, caKey := newTestCertificate(t, "test TLS CA", true, x509.KeyUsageCertSign, nil, nil)
+	serverCert, serverKey := newTestTLSCertificate(t, testTLSName, x509.ExtKeyUsageServerAuth, caCert, caKey)
+
+	scepCACert, scepCAKey := newTestCertificate(t, "test SCEP CA", true, x509.KeyUsageCertSign|x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment, nil, nil)
+	s := &testSCEPServer{
+		caCert: scepCACert,
+		caKey:  scepCAKey,
+		caps:   "Renewal\nSHA-1\nSHA-256\nAES\nDES3\nSCEPStandard\nPOSTPKIOperation",
+		csrs:   map[scep.TransactionID]*x509.CertificateRequest{},
+	}
+	s.Server = httptest.NewUnstartedServer(s)
+	s.Server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{serverCert.Raw}, PrivateKey: serverKey}},
+	}
+	if configure != nil {
+		configure(s.Server.TLS)
+	}
+	s.Server.StartTLS()
+	t.Cleanup(s.Close)
+	return s, pem.EncodeToMemory(&pem.Block{Type: certificatePEMBlockType, Bytes: caCert.Raw})
+}
+
+// newTestTLSCertificate creates a certificate for dnsName and its key, issued
+// by parent.
+func newTestTLSCertificate(t *testing.T, dnsName string, extKeyUsage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func TestTLS(t *testing.T) {
+	clientCA, clientCAKey := newTestCertificate(t, "test client CA", true, x509.KeyUsageCertSign, nil, nil)
+	clientCert, clientKey := newTestTLSCertificate(t, "client.example.com", x509.ExtKeyUsageClientAuth, clientCA, clientCAKey)
+	clientCertPEM := pem.EncodeToMemory(&pem.Block{Type: certificatePEMBlockType, Bytes: clientCert.Raw})
+	clientKeyPEM := pemKey(clientKey)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCA)
+	requireClientCertificate := func(config *tls.Config) {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+		config.ClientCAs = clientCAs
+	}
+	maxTLS12 := func(config *tls.Config) {
+		config.MaxVersion = tls.VersionTLS12
+	}
+
+	tests := map[string]struct {
+		configureServer func(*tls.Config)
+		tls             func(caBundle []byte) *scepissuerapi.TLSConfig
+		data            map[string][]byte
+		expectedError   error
+	}{
+		"success": {
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName}
+			},
+		},
+		"no-ca-bundle": {
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{ServerName: testTLSName}
+			},
+			expectedError: ErrUnreachable,
+		},
+		"no-tls-config": {
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return nil
+			},
+			expectedError: ErrUnreachable,
+		},
+		"server-name-mismatch": {
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle}
+			},
+			expectedError: ErrUnreachable,
+		},
+		"client-certificate": {
+			configureServer: requireClientCertificate,
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName, ClientCertificateSecretName: "client-certificate"}
+			},
+			data: map[string][]byte{
+				ClientCertificateKey: clientCertPEM,
+				ClientKeyKey:         clientKeyPEM,
+			},
+		},
+		"client-certificate-required": {
+			configureServer: requireClientCertificate,
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName}
+			},
+			expectedError: ErrUnreachable,
+		},
+		"min-version-tls13": {
+			configureServer: maxTLS12,
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName, MinVersion: scepissuerapi.TLSVersion13}
+			},
+			expectedError: ErrUnreachable,
+		},
+		"min-version-tls12": {
+			configureServer: maxTLS12,
+			tls: func(caBundle []byte) *scepissuerapi.TLSConfig {
+				return &scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName, MinVersion: scepissuerapi.TLSVersion12}
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			server, caBundle := newTestTLSSCEPServer(t, tc.configureServer)
+			checker, err := ScepHealthCheckerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+				URL: server.URL + "/scep",
+				TLS: tc.tls(caBundle),
+			}, tc.data)
+			require.Nil(t, err)
+
+			_, err = checker.Check(context.Background())
+			if tc.expectedError != nil {
+				require.ErrorIs(t, err, tc.expectedError)
+			} else {
+				require.Nil(t, err)
+			}
+		})
+	}
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	_, caBundle := newTestTLSSCEPServer(t, nil)
+
+	client, err := newHTTPClient(nil, nil)
+	require.Nil(t, err)
+	require.Same(t, http.DefaultClient, client)
+
+	client, err = newHTTPClient(&scepissuerapi.TLSConfig{CABundle: caBundle, ServerName: testTLSName}, nil)
+	require.Nil(t, err)
+	transport := client.Transport.(*http.Transport)
+	require.True(t, transport.DisableKeepAlives)
+	tlsConfig := transport.TLSClientConfig
+	require.Equal(t, testTLSName, tlsConfig.ServerName)
+	require.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	require.NotNil(t, tlsConfig.RootCAs)
+	require.NotSame(t, http.DefaultTransport, client.Transport)
+
+	tests := map[string]struct {
+		tls  *scepissuerapi.TLSConfig
+		data map[string][]byte
+	}{
+		"invalid-ca-bundle": {
+			tls: &scepissuerapi.TLSConfig{CABundle: []byte("not a certificate")},
+		},
+		"missing-client-certificate": {
+			tls: &scepissuerapi.TLSConfig{ClientCertificateSecretName: "client-certificate"},
+		},
+		"invalid-client-certificate": {
+			tls: &scepissuerapi.TLSConfig{ClientCertificateSecretName: "client-certificate"},
+			data: map[string][]byte{
+				ClientCertificateKey: caBundle,
+				ClientKeyKey:         []byte("not a key"),
+			},
+		},
+		"unsupported-min-version": {
+			tls: &scepissuerapi.TLSConfig{MinVersion: "TLS10"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := newHTTPClient(tc.tls, tc.data)
+			require.ErrorIs(t, err, ErrTLSConfig)
+
+			_, err = ScepSignerFromIssuerAndSecretData(logrtesting.NewTestLogger(t), &scepissuerapi.SCEPIssuerSpec{
+				URL: "https://" + testTLSName,
+				TLS: tc.tls,
+			}, nil, tc.data)
+			require.ErrorIs(t, err, ErrTLSConfig)
+		})
+	}
+}
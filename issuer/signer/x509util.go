@@ -17,10 +17,12 @@ limitations under the License.
 package signer
 
 import (
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
 	"fmt"
@@ -71,7 +73,9 @@ func parseCSR(pemBytes []byte) (*x509.CertificateRequest, error) {
 	return x509.ParseCertificateRequest(block.Bytes)
 }
 
-func selfSign(priv *rsa.PrivateKey, csr *x509.CertificateRequest) (*x509.Certificate, error) {
+// selfSign creates the certificate for priv the messages of a transaction are
+// signed with. It is valid for lifetime.
+func selfSign(priv *rsa.PrivateKey, csr *x509.CertificateRequest, lifetime time.Duration) (*x509.Certificate, error) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
@@ -79,7 +83,7 @@ func selfSign(priv *rsa.PrivateKey, csr *x509.CertificateRequest) (*x509.Certifi
 	}
 
 	notBefore := time.Now()
-	notAfter := notBefore.Add(time.Hour * 1)
+	notAfter := notBefore.Add(lifetime)
 	template := x509.Certificate{
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
@@ -101,7 +105,9 @@ func selfSign(priv *rsa.PrivateKey, csr *x509.CertificateRequest) (*x509.Certifi
 	return x509.ParseCertificate(derBytes)
 }
 
-func AddChallenge(csrBytes []byte, challenge string, privateKey *rsa.PrivateKey) ([]byte, error) {
+// AddChallenge adds the challenge password attribute to the PEM encoded CSR and
+// signs it again with privateKey, which may be an RSA, ECDSA or Ed25519 key.
+func AddChallenge(csrBytes []byte, challenge string, privateKey crypto.Signer) ([]byte, error) {
 	csrPEM, _ := pem.Decode(csrBytes)
 	csrX509, err := x509.ParseCertificateRequest(csrPEM.Bytes)
 	if err != nil {
@@ -116,14 +122,7 @@ func AddChallenge(csrBytes []byte, challenge string, privateKey *rsa.PrivateKey)
 		return nil, fmt.Errorf("challenge password already present in CSR")
 	}
 
-	randReader := rand.Reader
-
-	tmpl := &x509util.CertificateRequest{
-		CertificateRequest: *csrX509,
-		ChallengePassword:  challenge,
-	}
-
-	csrDER, err := x509util.CreateCertificateRequest(randReader, tmpl, privateKey)
+	csrDER, err := createCertificateRequest(csrX509, challenge, privateKey)
 	if err != nil {
 		return nil, err
 	}
@@ -143,3 +142,99 @@ func AddChallenge(csrBytes []byte, challenge string, privateKey *rsa.PrivateKey)
 
 	return csrPEMResult, nil
 }
+
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+// PKCS#10 structures, see RFC 2986 section 4
+type tbsCertificateRequest struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type certificateRequest struct {
+	Raw                asn1.RawContent
+	TBSCSR             tbsCertificateRequest
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type challengePasswordAttribute struct {
+	Type  asn1.ObjectIdentifier
+	Value []string `asn1:"set"`
+}
+
+// createCertificateRequest creates a DER encoded CSR from tmpl with the
+// challenge password attribute. Unlike x509util.CreateCertificateRequest it
+// can sign with Ed25519 keys.
+func createCertificateRequest(tmpl *x509.CertificateRequest, challenge string, key crypto.Signer) ([]byte, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, err
+	}
+	if challenge == "" {
+		return der, nil
+	}
+	signed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := signatureHash(signed.SignatureAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var csr certificateRequest
+	if _, err := asn1.Unmarshal(der, &csr); err != nil {
+		return nil, err
+	}
+	attribute, err := asn1.Marshal(challengePasswordAttribute{
+		Type:  oidChallengePassword,
+		Value: []string{challenge},
+	})
+	if err != nil {
+		return nil, err
+	}
+	csr.TBSCSR.Raw = nil
+	csr.TBSCSR.RawAttributes = append(csr.TBSCSR.RawAttributes, asn1.RawValue{FullBytes: attribute})
+	tbs, err := asn1.Marshal(csr.TBSCSR)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := tbs
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbs)
+		digest = h.Sum(nil)
+	}
+	signature, err := key.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificateRequest{
+		TBSCSR:             tbsCertificateRequest{Raw: tbs},
+		SignatureAlgorithm: csr.SignatureAlgorithm,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
+// signatureHash returns the hash x509.CreateCertificateRequest signs with for
+// algorithm, or zero if the message is signed directly.
+func signatureHash(algorithm x509.SignatureAlgorithm) (crypto.Hash, error) {
+	switch algorithm {
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		return crypto.SHA256, nil
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		return crypto.SHA384, nil
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		return crypto.SHA512, nil
+	case x509.PureEd25519:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("unsupported CSR signature algorithm %s", algorithm)
+	}
+}
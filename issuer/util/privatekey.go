@@ -0,0 +1,55 @@
+/*
+Copyright 2022 Marcel Heers.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/util/pki"
+)
+
+var (
+	ErrMalformedPrivateKey = errors.New("malformed private key")
+	ErrMalformedCSR        = errors.New("malformed CSR")
+	ErrPrivateKeyMismatch  = errors.New("private key does not match the public key of the CSR")
+)
+
+// PrivateKeyForCSR decodes the PEM encoded PKCS#1, PKCS#8 or SEC1 private key
+// and checks that it belongs to the PEM encoded CSR.
+func PrivateKeyForCSR(keyPEM, csrPEM []byte) (crypto.Signer, error) {
+	if len(keyPEM) == 0 {
+		return nil, fmt.Errorf("%w: no private key", ErrMalformedPrivateKey)
+	}
+	key, err := pki.DecodePrivateKeyBytes(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedPrivateKey, err)
+	}
+	csr, err := pki.DecodeX509CertificateRequestBytes(csrPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedCSR, err)
+	}
+	matches, err := pki.PublicKeyMatchesCSR(key.Public(), csr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedCSR, err)
+	}
+	if !matches {
+		return nil, ErrPrivateKeyMismatch
+	}
+	return key, nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2022 Marcel Heers.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrivateKeyForCSR(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	pkcs8 := func(key crypto.Signer) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+	sec1 := func(key *ecdsa.PrivateKey) []byte {
+		der, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+	}
+	csr := func(key crypto.Signer) []byte {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "test"},
+		}, key)
+		require.NoError(t, err)
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	}
+	pkcs1RSAKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	tests := map[string]struct {
+		key, csr    []byte
+		expectedErr error
+	}{
+		"pkcs1-rsa":         {key: pkcs1RSAKey, csr: csr(rsaKey)},
+		"pkcs8-rsa":         {key: pkcs8(rsaKey), csr: csr(rsaKey)},
+		"sec1-ecdsa":        {key: sec1(ecKey), csr: csr(ecKey)},
+		"pkcs8-ecdsa":       {key: pkcs8(ecKey), csr: csr(ecKey)},
+		"pkcs8-ed25519":     {key: pkcs8(edKey), csr: csr(edKey)},
+		"no-key":            {key: nil, csr: csr(rsaKey), expectedErr: ErrMalformedPrivateKey},
+		"not-pem":           {key: []byte("not a private key"), csr: csr(rsaKey), expectedErr: ErrMalformedPrivateKey},
+		"corrupt-der":       {key: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte{0x30, 0x00}}), csr: csr(rsaKey), expectedErr: ErrMalformedPrivateKey},
+		"malformed-csr":     {key: pkcs1RSAKey, csr: []byte("not a CSR"), expectedErr: ErrMalformedCSR},
+		"mismatch":          {key: pkcs1RSAKey, csr: csr(ecKey), expectedErr: ErrPrivateKeyMismatch},
+		"mismatch-same-alg": {key: sec1(ecKey), csr: csr(mustECDSAKey(t)), expectedErr: ErrPrivateKeyMismatch},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := PrivateKeyForCSR(tc.key, tc.csr)
+			if tc.expectedErr != nil {
+				assert.ErrorIs(t, err, tc.expectedErr)
+				assert.Nil(t, key)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, key)
+		})
+	}
+}
+
+func mustECDSAKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return key
+}
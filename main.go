@@ -134,16 +134,22 @@ func main() {
 	}
 
 	if err = (&controllers.SCEPIssuerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-		Kind:   "SCEPIssuer",
+		Client:               mgr.GetClient(),
+		Scheme:               mgr.GetScheme(),
+		Kind:                 "SCEPIssuer",
+		HealthCheckerBuilder: signer.ScepHealthCheckerFromIssuerAndSecretData,
+		Recorder:             mgr.GetEventRecorderFor("scepissuer-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Issuer")
 		os.Exit(1)
 	}
-	if err = (&controllers.ClusterIssuerReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+	if err = (&controllers.SCEPIssuerReconciler{
+		Client:                   mgr.GetClient(),
+		Scheme:                   mgr.GetScheme(),
+		Kind:                     "SCEPClusterIssuer",
+		ClusterResourceNamespace: clusterResourceNamespace,
+		HealthCheckerBuilder:     signer.ScepHealthCheckerFromIssuerAndSecretData,
+		Recorder:                 mgr.GetEventRecorderFor("scepclusterissuer-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ClusterIssuer")
 		os.Exit(1)
@@ -155,6 +161,7 @@ func main() {
 		SignerBuilder:            signer.ScepSignerFromIssuerAndSecretData,
 		CheckApprovedCondition:   !disableApprovedCheck,
 		Clock:                    clock.RealClock{},
+		Recorder:                 mgr.GetEventRecorderFor("certificaterequests-controller"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "CertificateRequest")
 		os.Exit(1)